@@ -10,8 +10,9 @@ echo "Building Docker images for all services..."
 
 for service in "${SERVICES[@]}"; do
     echo "Building $service..."
-    cd "../../services/$service"
-    docker build -t "$service:latest" .
+    # Built from the services directory so the shared module is in the context
+    cd "../../services"
+    docker build -t "$service:latest" -f "$service/Dockerfile" .
     echo "✅ Built $service:latest"
     cd - > /dev/null
 done
@@ -22,6 +22,12 @@ kubectl apply -f kafka/kafka-cluster.yaml
 echo "⏳ Waiting for Kafka cluster to be ready..."
 kubectl wait --for=condition=ready --timeout=600s kafka/my-cluster -n kafka
 
+# Create the JWT signing secret the services validate tokens with
+if ! kubectl get secret jwt-auth >/dev/null 2>&1; then
+    echo "🔑 Creating JWT secret..."
+    kubectl create secret generic jwt-auth --from-literal=secret="$(openssl rand -hex 32)"
+fi
+
 # Deploy all microservices
 SERVICES=("order-service" "inventory-service" "payment-service" "notification-service" "shipping-service" "status-service")
 
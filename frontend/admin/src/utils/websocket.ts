@@ -1,4 +1,4 @@
-import { Order, WebSocketMessage } from '../types';
+import { Order, OrderFeedMessage, OrderSubscription, WebSocketMessage } from '../types';
 
 export class WebSocketClient {
   private ws: WebSocket | null = null;
@@ -112,6 +112,75 @@ export class WebSocketClient {
   }
 }
 
+// OrderFeedClient follows many orders over a single connection to the
+// status-service feed. Subscriptions are filtered server-side and re-sent
+// after every reconnect.
+export class OrderFeedClient {
+  private ws: WebSocket | null = null;
+  private subscriptions = new Map<string, OrderSubscription>();
+  private onMessage: (message: OrderFeedMessage) => void;
+  private reconnectAttempts = 0;
+  private maxReconnectAttempts = 5;
+  private reconnectTimeout: NodeJS.Timeout | null = null;
+
+  constructor(onMessage: (message: OrderFeedMessage) => void) {
+    this.onMessage = onMessage;
+  }
+
+  connect(): void {
+    const hostname = typeof window !== 'undefined' ? window.location.hostname : 'localhost';
+    this.ws = new WebSocket(`ws://${hostname}:8087/ws`);
+
+    this.ws.onopen = () => {
+      this.reconnectAttempts = 0;
+      this.subscriptions.forEach((subscription) => this.send('subscribe', subscription));
+    };
+
+    this.ws.onmessage = (event) => {
+      try {
+        this.onMessage(JSON.parse(event.data) as OrderFeedMessage);
+      } catch (error) {
+        console.error('Failed to parse order feed message:', error);
+      }
+    };
+
+    this.ws.onclose = (event) => {
+      if (!event.wasClean && this.reconnectAttempts < this.maxReconnectAttempts) {
+        this.reconnectAttempts++;
+        const delay = Math.min(1000 * Math.pow(2, this.reconnectAttempts), 30000);
+        this.reconnectTimeout = setTimeout(() => this.connect(), delay);
+      }
+    };
+  }
+
+  subscribe(subscription: OrderSubscription): void {
+    this.subscriptions.set(subscription.id, subscription);
+    this.send('subscribe', subscription);
+  }
+
+  unsubscribe(id: string): void {
+    this.subscriptions.delete(id);
+    this.send('unsubscribe', { id });
+  }
+
+  disconnect(): void {
+    if (this.reconnectTimeout) {
+      clearTimeout(this.reconnectTimeout);
+      this.reconnectTimeout = null;
+    }
+    if (this.ws) {
+      this.ws.close(1000, 'Client disconnect');
+      this.ws = null;
+    }
+  }
+
+  private send(action: 'subscribe' | 'unsubscribe', subscription: OrderSubscription): void {
+    if (this.ws?.readyState === WebSocket.OPEN) {
+      this.ws.send(JSON.stringify({ action, subscription }));
+    }
+  }
+}
+
 // React Hook for WebSocket management
 export function createWebSocketHook() {
   return function useOrderTracking(
@@ -7,8 +7,12 @@ export interface Order {
   product_id: string;
   quantity: number;
   status: string;
+  notification_status?: 'pending' | 'sent';
+  fulfilment_status?: 'pending' | 'shipped' | 'cancelled';
+  provisional?: boolean;
   events: OrderEvent[];
   last_updated: string;
+  last_event_at?: string;
   tracking_number?: string;
   payment_amount?: number;
   // New fields for admin functionality
@@ -20,8 +24,10 @@ export interface Order {
 }
 
 export interface OrderEvent {
+  id?: string;
   event_type: string;
   data: string;
+  occurred_at?: string;
   timestamp: string;
 }
 
@@ -323,6 +329,26 @@ export interface WebSocketMessage {
   timestamp: string;
 }
 
+// Order feed (status-service /ws): subscribe to many orders over one socket.
+export interface OrderSubscription {
+  id: string;
+  all?: boolean;
+  order_id?: string;
+  status?: string;
+  product_id?: string;
+  customer_id?: string;
+}
+
+export interface OrderFeedMessage {
+  type: 'order_update' | 'order_deleted' | 'resync' | 'subscribed' | 'unsubscribed' | 'subscriptions' | 'error';
+  subscriptions?: string[];
+  subscription?: OrderSubscription;
+  active?: OrderSubscription[];
+  order_id?: string;
+  order?: Order;
+  error?: string;
+}
+
 // API Response Types
 export interface ApiResponse<T = any> {
   data: T;
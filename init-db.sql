@@ -136,6 +136,9 @@ CREATE TABLE IF NOT EXISTS shipments (
 -- Connect to status_service_db and create tables
 \c status_service_db;
 
+-- Trigram indexes back status-service order search (see services/status-service/postgres_store.go)
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
 CREATE TABLE IF NOT EXISTS order_status (
     id SERIAL PRIMARY KEY,
     order_id VARCHAR(255) NOT NULL,
@@ -70,10 +70,11 @@ build_and_push_services() {
         
         # サービスディレクトリに移動してビルド
         (
-            cd "services/$service"
+            # 共有モジュールを含めるため services ディレクトリをコンテキストにする
+            cd "services"
             
             # Dockerfileが存在するか確認
-            if [[ ! -f "Dockerfile" ]]; then
+            if [[ ! -f "$service/Dockerfile" ]]; then
                 log_error "Dockerfile not found in services/$service"
                 exit 1
             fi
@@ -81,6 +82,7 @@ build_and_push_services() {
             # マルチプラットフォームビルド（本番環境でARM64を使用する場合）
             docker buildx build \
                 --platform linux/amd64,linux/arm64 \
+                -f "$service/Dockerfile" \
                 -t "$image_tag" \
                 -t "$latest_tag" \
                 --push .
@@ -125,8 +125,9 @@ build_and_push() {
         
         # サービスディレクトリに移動してビルド
         (
-            cd "services/$service"
-            docker build -t "$image_tag" -t "$latest_tag" .
+            # 共有モジュールを含めるため services ディレクトリをコンテキストにする
+            cd "services"
+            docker build -f "$service/Dockerfile" -t "$image_tag" -t "$latest_tag" .
             docker push "$image_tag"
             docker push "$latest_tag"
         )
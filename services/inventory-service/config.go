@@ -0,0 +1,30 @@
+package main
+
+import (
+	"shared/auth"
+	"shared/config"
+	"shared/kafkaconn"
+	"shared/logging"
+)
+
+type Config struct {
+	config.Common `yaml:",inline"`
+}
+
+// cfg is initialised before any other package state that reads it, so an
+// invalid configuration stops the service before it touches Kafka.
+var cfg = loadConfig()
+
+// kafkaConn carries the broker, TLS and SASL settings to every Kafka client.
+var kafkaConn = kafkaconn.MustNew(cfg.Kafka)
+
+// authn validates the bearer tokens of API requests.
+var authn = auth.MustNew(cfg.Auth)
+
+func loadConfig() *Config {
+	logging.Init("inventory-service")
+
+	c := &Config{Common: config.Defaults("inventory-service", 8081)}
+	config.MustLoad(c)
+	return c
+}
@@ -4,15 +4,22 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
-	"os"
 	"strconv"
 	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/segmentio/kafka-go"
+
+	"shared/audit"
+	"shared/config"
+	"shared/health"
+	"shared/lag"
+	"shared/logging"
+	"shared/metrics"
+	"shared/tracing"
 )
 
 type OrderCreatedEvent struct {
@@ -136,6 +143,18 @@ func (inv *Inventory) GetProduct(productID string) (*Product, bool) {
 	return product, exists
 }
 
+// Snapshot returns a copy of the product, safe to read while stock changes.
+func (inv *Inventory) Snapshot(productID string) (Product, bool) {
+	inv.mu.RLock()
+	defer inv.mu.RUnlock()
+
+	product, exists := inv.products[productID]
+	if !exists {
+		return Product{}, false
+	}
+	return *product, true
+}
+
 func (inv *Inventory) AddProduct(product *Product) error {
 	inv.mu.Lock()
 	defer inv.mu.Unlock()
@@ -221,6 +240,9 @@ func (inv *Inventory) addHistory(productID, action string, quantity int, reason
 	}
 	
 	inv.history = append(inv.history, history)
+	if product, exists := inv.products[productID]; exists {
+		metrics.StockLevel.WithLabelValues(productID).Set(float64(product.Stock))
+	}
 	
 	// Keep only last 1000 history records
 	if len(inv.history) > 1000 {
@@ -230,19 +252,17 @@ func (inv *Inventory) addHistory(productID, action string, quantity int, reason
 
 var inventory = NewInventory()
 
-func getKafkaBroker() string {
-	if broker := os.Getenv("KAFKA_BROKER"); broker != "" {
-		return broker
-	}
-	return "localhost:9092"
-}
+// healthChecker backs /health, /health/live and /health/ready.
+var healthChecker = health.New("inventory-service")
 
-func publishInventoryEvent(event InventoryEvent) error {
-	writer := &kafka.Writer{
-		Addr:     kafka.TCP(getKafkaBroker()),
-		Topic:    "inventory",
-		Balancer: &kafka.LeastBytes{},
-	}
+// lagTracker backs /consumer/lag.
+var lagTracker = lag.NewTracker("inventory-service", cfg.Kafka.GroupID, kafkaConn, cfg.Kafka.Topics.Orders)
+
+// auditor publishes an AdminActionPerformed event for every admin change.
+var auditor = audit.NewPublisher("inventory-service", kafkaConn, cfg.Kafka.Topics.Audit)
+
+func publishInventoryEvent(ctx context.Context, event InventoryEvent) error {
+	writer := kafkaConn.Writer(cfg.Kafka.Topics.Inventory)
 	defer writer.Close()
 
 	eventBytes, err := json.Marshal(event)
@@ -250,17 +270,25 @@ func publishInventoryEvent(event InventoryEvent) error {
 		return err
 	}
 
-	return writer.WriteMessages(context.Background(),
-		kafka.Message{
-			Key:   []byte(event.OrderID),
-			Value: eventBytes,
-		},
-	)
+	msg := kafka.Message{
+		Key:   []byte(event.OrderID),
+		Value: eventBytes,
+	}
+
+	ctx, span := tracing.StartPublish(ctx, cfg.Kafka.Topics.Inventory, &msg)
+	ctx = logging.WithEventID(ctx, logging.EventID(eventBytes))
+	start := time.Now()
+	err = writer.WriteMessages(ctx, msg)
+	metrics.ObservePublish(cfg.Kafka.Topics.Inventory, start, err)
+	tracing.End(span, err)
+	if err == nil {
+		slog.DebugContext(ctx, "Event published", "topic", cfg.Kafka.Topics.Inventory)
+	}
+	return err
 }
 
-func processOrderEvent(event OrderCreatedEvent) {
-	log.Printf("Processing order: %s for product: %s, quantity: %d", 
-		event.OrderID, event.ProductID, event.Quantity)
+func processOrderEvent(ctx context.Context, event OrderCreatedEvent) {
+	slog.InfoContext(ctx, "Processing order", "product_id", event.ProductID, "quantity", event.Quantity)
 
 	var inventoryEvent InventoryEvent
 	inventoryEvent.OrderID = event.OrderID
@@ -269,40 +297,61 @@ func processOrderEvent(event OrderCreatedEvent) {
 
 	if inventory.ReserveStock(event.ProductID, event.Quantity) {
 		inventoryEvent.EventType = "InventoryConfirmed"
-		log.Printf("Inventory confirmed for order: %s", event.OrderID)
+		slog.InfoContext(ctx, "Inventory confirmed")
 	} else {
 		inventoryEvent.EventType = "InventoryRejected"
 		inventoryEvent.Reason = "Insufficient stock"
-		log.Printf("Inventory rejected for order: %s - insufficient stock", event.OrderID)
+
+		reason := "insufficient_stock"
+		if _, exists := inventory.GetProduct(event.ProductID); !exists {
+			reason = "unknown_product"
+		}
+		metrics.ReservationsRejected.WithLabelValues(reason).Inc()
+		slog.WarnContext(ctx, "Inventory rejected", "reason", reason)
 	}
 
-	if err := publishInventoryEvent(inventoryEvent); err != nil {
-		log.Printf("Failed to publish inventory event: %v", err)
+	if err := publishInventoryEvent(ctx, inventoryEvent); err != nil {
+		slog.ErrorContext(ctx, "Failed to publish inventory event", "error", err)
 	}
 }
 
 func consumeOrders() {
-	reader := kafka.NewReader(kafka.ReaderConfig{
-		Brokers: []string{getKafkaBroker()},
-		Topic:   "orders",
-		GroupID: "inventory-service",
+	loop := healthChecker.Loop("consume-orders")
+	loop.Run()
+	defer loop.Exit()
+
+	reader := kafkaConn.Reader(kafka.ReaderConfig{
+		Topic:   cfg.Kafka.Topics.Orders,
+		GroupID: cfg.Kafka.GroupID,
 	})
 	defer reader.Close()
 
 	for {
 		msg, err := reader.ReadMessage(context.Background())
 		if err != nil {
-			log.Printf("Error reading message: %v", err)
+			slog.Error("Error reading message", "topic", cfg.Kafka.Topics.Orders, "error", err)
+			loop.Fail(err)
 			continue
 		}
+		loop.Beat()
+		ctx, span := tracing.StartConsume(msg)
+		ctx = logging.WithEventID(ctx, logging.EventID(msg.Value))
+		start := time.Now()
 
 		var event OrderCreatedEvent
 		if err := json.Unmarshal(msg.Value, &event); err != nil {
-			log.Printf("Error unmarshaling message: %v", err)
+			slog.ErrorContext(ctx, "Error unmarshaling message", "topic", msg.Topic, "error", err)
+			metrics.ObserveConsume(msg.Topic, start, err)
+			tracing.End(span, err)
 			continue
 		}
 
-		processOrderEvent(event)
+		ctx = logging.WithOrderID(ctx, event.OrderID)
+		tracing.OrderID(ctx, event.OrderID)
+		processOrderEvent(ctx, event)
+		metrics.ObserveConsume(msg.Topic, start, nil)
+		tracing.End(span, nil)
+		lagTracker.Processed(msg)
 	}
 }
 
@@ -344,6 +393,8 @@ func addProduct(c *gin.Context) {
 		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
 		return
 	}
+	after, _ := inventory.Snapshot(product.ID)
+	auditor.Record(c, "inventory.product.create", "product/"+product.ID, nil, after)
 	
 	c.JSON(http.StatusCreated, gin.H{
 		"message": "Product added successfully",
@@ -364,10 +415,13 @@ func updateStock(c *gin.Context) {
 		return
 	}
 	
+	before, _ := inventory.Snapshot(productID)
 	if err := inventory.UpdateStock(productID, req.Quantity, req.Reason); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	after, _ := inventory.Snapshot(productID)
+	auditor.Record(c, "inventory.stock.update", "product/"+productID, before, after)
 	
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Stock updated successfully",
@@ -384,10 +438,13 @@ func setAlertLevel(c *gin.Context) {
 		return
 	}
 	
+	before, _ := inventory.Snapshot(productID)
 	if err := inventory.SetAlertLevel(productID, level); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	after, _ := inventory.Snapshot(productID)
+	auditor.Record(c, "inventory.alert_level.update", "product/"+productID, before, after)
 	
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Alert level updated successfully",
@@ -410,14 +467,24 @@ func getInventoryHistory(c *gin.Context) {
 	})
 }
 
-func healthCheck(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"status": "healthy", "service": "inventory-service"})
-}
-
 func main() {
+	metrics.Init("inventory-service", metrics.ReservationsRejected, metrics.StockLevel)
+	tracing.Init("inventory-service")
+	kafkaConn.MustEnsureTopics(context.Background())
+	go auditor.CheckTopic(context.Background())
+	for productID, stock := range inventory.GetStock() {
+		metrics.StockLevel.WithLabelValues(productID).Set(float64(stock))
+	}
+
+	healthChecker.AddCheck("kafka", health.KafkaCheck(kafkaConn))
+
 	go consumeOrders()
 
-	r := gin.Default()
+	r := gin.New()
+	r.Use(gin.Recovery())
+	r.Use(tracing.Middleware())
+	r.Use(logging.Middleware())
+	r.Use(metrics.Middleware())
 	
 	// CORS middleware
 	r.Use(func(c *gin.Context) {
@@ -432,10 +499,15 @@ func main() {
 		
 		c.Next()
 	})
+	r.Use(authn.Middleware())
+	r.Use(authn.Authorize("inventory-service"))
 	
 	// Existing endpoints
 	r.GET("/inventory", getInventory)
-	r.GET("/health", healthCheck)
+	healthChecker.Register(r)
+	metrics.Register(r)
+	config.Register(r, cfg)
+	lagTracker.Register(r)
 	
 	// New management endpoints
 	r.GET("/products", getProducts)
@@ -446,15 +518,6 @@ func main() {
 	r.GET("/alerts/low-stock", getLowStockProducts)
 	r.GET("/history", getInventoryHistory)
 
-	log.Println("Inventory Service starting on :8081")
-	log.Println("Management API endpoints:")
-	log.Println("  GET    /products          - Get all products")
-	log.Println("  GET    /products/:id      - Get product by ID")
-	log.Println("  POST   /products          - Add new product")
-	log.Println("  PUT    /products/:id/stock - Update stock")
-	log.Println("  PUT    /products/:id/alert/:level - Set alert level")
-	log.Println("  GET    /alerts/low-stock  - Get low stock products")
-	log.Println("  GET    /history           - Get inventory history")
-	
-	r.Run(":8081")
+	slog.Info("Inventory Service starting", "addr", cfg.Addr())
+	r.Run(cfg.Addr())
 }
\ No newline at end of file
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Granularity is the width of an analytics bucket.
+type Granularity string
+
+const (
+	Hourly  Granularity = "hour"
+	Daily   Granularity = "day"
+	Weekly  Granularity = "week"
+	Monthly Granularity = "month"
+)
+
+var granularities = []Granularity{Hourly, Daily, Weekly, Monthly}
+
+// maxSeriesPoints caps how many buckets a single series may span.
+const maxSeriesPoints = 2000
+
+func parseGranularity(value string) (Granularity, error) {
+	for _, g := range granularities {
+		if string(g) == value {
+			return g, nil
+		}
+	}
+	return "", fmt.Errorf("invalid group_by %q (use hour, day, week or month)", value)
+}
+
+// Truncate returns the start of the bucket containing t. Buckets are in UTC
+// and weeks start on Monday.
+func (g Granularity) Truncate(t time.Time) time.Time {
+	t = t.UTC()
+	switch g {
+	case Hourly:
+		return t.Truncate(time.Hour)
+	case Weekly:
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case Monthly:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+}
+
+// Next returns the start of the bucket after the one starting at start.
+func (g Granularity) Next(start time.Time) time.Time {
+	switch g {
+	case Hourly:
+		return start.Add(time.Hour)
+	case Weekly:
+		return start.AddDate(0, 0, 7)
+	case Monthly:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+// Label formats a bucket start for API responses.
+func (g Granularity) Label(start time.Time) string {
+	switch g {
+	case Hourly:
+		return start.Format("2006-01-02T15:00")
+	case Monthly:
+		return start.Format("2006-01")
+	default:
+		return start.Format("2006-01-02")
+	}
+}
+
+// BucketStats are the counters kept per bucket and product.
+type BucketStats struct {
+	Orders    int            `json:"orders"`     // orders placed
+	Quantity  int            `json:"quantity"`   // units ordered
+	Paid      int            `json:"paid"`       // orders paid
+	ItemsSold int            `json:"items_sold"` // units on paid orders
+	Revenue   float64        `json:"revenue"`
+	Statuses  map[string]int `json:"statuses"` // orders reaching each status
+}
+
+func (b *BucketStats) add(other *BucketStats, sign int) {
+	b.Orders += sign * other.Orders
+	b.Quantity += sign * other.Quantity
+	b.Paid += sign * other.Paid
+	b.ItemsSold += sign * other.ItemsSold
+	b.Revenue += float64(sign) * other.Revenue
+	for status, count := range other.Statuses {
+		if b.Statuses == nil {
+			b.Statuses = make(map[string]int)
+		}
+		b.Statuses[status] += sign * count
+		if b.Statuses[status] == 0 {
+			delete(b.Statuses, status)
+		}
+	}
+}
+
+func (b *BucketStats) isEmpty() bool {
+	return b.Orders == 0 && b.Paid == 0 && b.Revenue == 0 && len(b.Statuses) == 0
+}
+
+func (b *BucketStats) Completed() int { return b.Statuses[StatusShipped] }
+
+func (b *BucketStats) Cancelled() int {
+	return b.Statuses[StatusInventoryRejected] + b.Statuses[StatusPaymentFailed]
+}
+
+func (b *BucketStats) FailureRate() float64 {
+	if b.Orders == 0 {
+		return 0
+	}
+	return float64(b.Cancelled()) / float64(b.Orders) * 100
+}
+
+func (b *BucketStats) AvgOrderValue() float64 {
+	if b.Paid == 0 {
+		return 0
+	}
+	return b.Revenue / float64(b.Paid)
+}
+
+// orderFact is one lifecycle event of an order that contributes to buckets.
+type orderFact struct {
+	EventType string
+	At        time.Time
+	Amount    float64
+}
+
+// orderContribution is what a single order has added to the buckets, kept so
+// it can be withdrawn when late events change the order's product or quantity.
+type orderContribution struct {
+	productID string
+	quantity  int
+	facts     []orderFact
+}
+
+type bucketKey struct {
+	start     int64 // bucket start, unix seconds
+	productID string
+}
+
+// AnalyticsStore rolls order events into hour, day, week and month buckets per
+// product, so ranges of any length are answered without scanning orders.
+type AnalyticsStore struct {
+	mu            sync.RWMutex
+	buckets       map[Granularity]map[bucketKey]*BucketStats
+	contributions map[string]orderContribution
+}
+
+func NewAnalyticsStore() *AnalyticsStore {
+	buckets := make(map[Granularity]map[bucketKey]*BucketStats)
+	for _, g := range granularities {
+		buckets[g] = make(map[bucketKey]*BucketStats)
+	}
+	return &AnalyticsStore{
+		buckets:       buckets,
+		contributions: make(map[string]orderContribution),
+	}
+}
+
+// Record replaces the contribution of orderID with one derived from its
+// current product, quantity and facts.
+func (s *AnalyticsStore) Record(orderID, productID string, quantity int, facts []orderFact) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if previous, exists := s.contributions[orderID]; exists {
+		s.apply(previous, -1)
+	}
+	contribution := orderContribution{
+		productID: productID,
+		quantity:  quantity,
+		facts:     append([]orderFact(nil), facts...),
+	}
+	s.contributions[orderID] = contribution
+	s.apply(contribution, 1)
+}
+
+func (s *AnalyticsStore) apply(contribution orderContribution, sign int) {
+	for _, fact := range contribution.facts {
+		delta := &BucketStats{}
+		switch fact.EventType {
+		case "OrderCreated":
+			delta.Orders = 1
+			delta.Quantity = contribution.quantity
+		case "PaymentCompleted":
+			delta.Paid = 1
+			delta.ItemsSold = contribution.quantity
+			delta.Revenue = fact.Amount
+		}
+		if status, ok := eventStatuses[fact.EventType]; ok {
+			delta.Statuses = map[string]int{status: 1}
+		}
+
+		for _, g := range granularities {
+			key := bucketKey{start: g.Truncate(fact.At).Unix(), productID: contribution.productID}
+			bucket, exists := s.buckets[g][key]
+			if !exists {
+				bucket = &BucketStats{}
+				s.buckets[g][key] = bucket
+			}
+			bucket.add(delta, sign)
+			if bucket.isEmpty() {
+				delete(s.buckets[g], key)
+			}
+		}
+	}
+}
+
+// bucketCount returns how many buckets of g the range [from, to) touches.
+func (g Granularity) bucketCount(from, to time.Time) int {
+	count := 0
+	for start := g.Truncate(from); start.Before(to) && count <= maxSeriesPoints; start = g.Next(start) {
+		count++
+	}
+	return count
+}
+
+// SeriesPoint is one bucket of a time series.
+type SeriesPoint struct {
+	Start time.Time
+	Label string
+	Stats BucketStats
+}
+
+// Series returns one point per bucket from the bucket containing from up to
+// (excluding) to, including empty buckets. productID filters to one product
+// when set.
+func (s *AnalyticsStore) Series(g Granularity, from, to time.Time, productID string) []SeriesPoint {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var points []SeriesPoint
+	index := make(map[int64]int)
+	for start := g.Truncate(from); start.Before(to); start = g.Next(start) {
+		index[start.Unix()] = len(points)
+		points = append(points, SeriesPoint{Start: start, Label: g.Label(start)})
+	}
+
+	for key, bucket := range s.buckets[g] {
+		if i, ok := index[key.start]; ok && (productID == "" || key.productID == productID) {
+			points[i].Stats.add(bucket, 1)
+		}
+	}
+	return points
+}
+
+// ByProduct totals hourly buckets in [from, to) per product.
+func (s *AnalyticsStore) ByProduct(from, to time.Time) map[string]*BucketStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	fromUnix, toUnix := Hourly.Truncate(from).Unix(), to.Unix()
+	totals := make(map[string]*BucketStats)
+	for key, bucket := range s.buckets[Hourly] {
+		if key.start < fromUnix || key.start >= toUnix {
+			continue
+		}
+		total, exists := totals[key.productID]
+		if !exists {
+			total = &BucketStats{}
+			totals[key.productID] = total
+		}
+		total.add(bucket, 1)
+	}
+	return totals
+}
+
+// Total sums hourly buckets in [from, to), optionally for one product.
+func (s *AnalyticsStore) Total(from, to time.Time, productID string) BucketStats {
+	var total BucketStats
+	for id, stats := range s.ByProduct(from, to) {
+		if productID == "" || id == productID {
+			total.add(stats, 1)
+		}
+	}
+	return total
+}
+
+// growthRate is the percentage change from previous to current; zero when
+// there is no previous value to compare against.
+func growthRate(current, previous float64) float64 {
+	if previous == 0 {
+		return 0
+	}
+	return (current - previous) / previous * 100
+}
+
+// sortedProductIDs returns the keys of totals ordered by revenue, then ID.
+func sortedProductIDs(totals map[string]*BucketStats) []string {
+	ids := make([]string, 0, len(totals))
+	for id := range totals {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if totals[ids[i]].Revenue != totals[ids[j]].Revenue {
+			return totals[ids[i]].Revenue > totals[ids[j]].Revenue
+		}
+		return ids[i] < ids[j]
+	})
+	return ids
+}
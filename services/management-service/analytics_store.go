@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// analyticsStoreTimeout bounds one write of the aggregate store.
+const analyticsStoreTimeout = 10 * time.Second
+
+// aggregateSchema stores every folded order with the facts its analytics
+// contribution is derived from, and for each partition of the order topics
+// the offset folded in up to and the time from which its events are
+// complete, if some were deleted before being folded in.
+var aggregateSchema = []string{
+	`CREATE TABLE IF NOT EXISTS analytics_orders (
+		order_id   VARCHAR(255) PRIMARY KEY,
+		fact_count INT NOT NULL,
+		record     TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS analytics_offsets (
+		topic        VARCHAR(255) NOT NULL,
+		partition_id INT NOT NULL,
+		next_offset  BIGINT NOT NULL,
+		covered_from TIMESTAMPTZ,
+		PRIMARY KEY (topic, partition_id)
+	)`,
+}
+
+// storedOrder is the stored form of an OrderRecord.
+type storedOrder struct {
+	OrderRecord
+	Facts []orderFact `json:"facts"`
+}
+
+// AggregateStore persists the orders the analytics buckets are built from, so
+// ranges older than the order topics' retention survive a restart. Every
+// replica folds the same events, so an order is only overwritten by a record
+// with more facts.
+type AggregateStore struct {
+	db *sql.DB
+}
+
+func NewAggregateStore(db *sql.DB) (*AggregateStore, error) {
+	if err := migrate(db, aggregateSchema); err != nil {
+		return nil, fmt.Errorf("migrate analytics schema: %w", err)
+	}
+	return &AggregateStore{db: db}, nil
+}
+
+// Orders returns every stored order.
+func (s *AggregateStore) Orders(ctx context.Context) ([]OrderRecord, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT record FROM analytics_orders`)
+	if err != nil {
+		return nil, fmt.Errorf("read analytics orders: %w", err)
+	}
+	defer rows.Close()
+
+	orders := []OrderRecord{}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("read analytics orders: %w", err)
+		}
+		var stored storedOrder
+		if err := json.Unmarshal([]byte(data), &stored); err != nil {
+			return nil, fmt.Errorf("decode analytics order: %w", err)
+		}
+		stored.OrderRecord.facts = stored.Facts
+		orders = append(orders, stored.OrderRecord)
+	}
+	return orders, rows.Err()
+}
+
+// Checkpoints returns the next offset to fold in for each partition, and the
+// latest time from which any partition's events are complete.
+func (s *AggregateStore) Checkpoints(ctx context.Context) (map[string]map[int]int64, time.Time, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT topic, partition_id, next_offset, covered_from FROM analytics_offsets`)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("read analytics offsets: %w", err)
+	}
+	defer rows.Close()
+
+	checkpoints := make(map[string]map[int]int64)
+	var coveredFrom time.Time
+	for rows.Next() {
+		var topic string
+		var partition int
+		var offset int64
+		var from sql.NullTime
+		if err := rows.Scan(&topic, &partition, &offset, &from); err != nil {
+			return nil, time.Time{}, fmt.Errorf("read analytics offsets: %w", err)
+		}
+		if checkpoints[topic] == nil {
+			checkpoints[topic] = make(map[int]int64)
+		}
+		checkpoints[topic][partition] = offset
+		if from.Valid && from.Time.After(coveredFrom) {
+			coveredFrom = from.Time
+		}
+	}
+	return checkpoints, coveredFrom, rows.Err()
+}
+
+// Save stores order, if msg changed one, and records msg as folded in. A
+// non-zero lostBefore records that the partition's events before it were
+// deleted unfolded.
+func (s *AggregateStore) Save(ctx context.Context, msg kafka.Message, order *OrderRecord, lostBefore time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if order != nil {
+		data, err := json.Marshal(storedOrder{OrderRecord: *order, Facts: order.facts})
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO analytics_orders (order_id, fact_count, record)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (order_id) DO UPDATE SET fact_count = EXCLUDED.fact_count, record = EXCLUDED.record
+			WHERE analytics_orders.fact_count < EXCLUDED.fact_count`,
+			order.OrderID, len(order.facts), string(data))
+		if err != nil {
+			return fmt.Errorf("save analytics order %s: %w", order.OrderID, err)
+		}
+	}
+
+	var coveredFrom sql.NullTime
+	if !lostBefore.IsZero() {
+		coveredFrom = sql.NullTime{Time: lostBefore, Valid: true}
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO analytics_offsets (topic, partition_id, next_offset, covered_from)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (topic, partition_id) DO UPDATE SET
+			next_offset = GREATEST(analytics_offsets.next_offset, EXCLUDED.next_offset),
+			covered_from = GREATEST(analytics_offsets.covered_from, EXCLUDED.covered_from)`,
+		msg.Topic, msg.Partition, msg.Offset+1, coveredFrom)
+	if err != nil {
+		return fmt.Errorf("save analytics offset: %w", err)
+	}
+	return tx.Commit()
+}
+
+// Coverage tells a client whether the analytics for a range count every
+// order event.
+type Coverage struct {
+	// From is the time from which every order event is counted; null when
+	// none has been lost.
+	From *time.Time `json:"from"`
+	// Complete reports whether the range, and any previous period it is
+	// compared against, starts at or after From.
+	Complete bool `json:"complete"`
+}
+
+// AnalyticsCoverage persists each folded order event through the aggregate
+// store, when there is one, and works out from when the analytics are
+// complete. Events are lost when retention deletes them from a topic before
+// they are folded in: without a store, every deleted event, since the
+// aggregate is rebuilt from the topics on each start; with one, those past
+// the partition's checkpoint. The first message consumed from each partition
+// shows whether any were: if its offset is past the checkpoint, the
+// partition is complete only from its time on.
+type AnalyticsCoverage struct {
+	store *AggregateStore // nil keeps the aggregate in memory only
+
+	mu          sync.RWMutex
+	checkpoints map[string]map[int]int64 // next offset stored before this start
+	started     map[string]map[int]bool  // partitions consumed from since this start
+	from        time.Time
+}
+
+func NewAnalyticsCoverage(store *AggregateStore) *AnalyticsCoverage {
+	return &AnalyticsCoverage{
+		store:       store,
+		checkpoints: make(map[string]map[int]int64),
+		started:     make(map[string]map[int]bool),
+	}
+}
+
+// analyticsCoverage is set up by startBackground, before the consumer starts.
+var analyticsCoverage *AnalyticsCoverage
+
+// Load restores the stored orders into aggregator and reads the stored
+// checkpoints. It does nothing without a store.
+func (c *AnalyticsCoverage) Load(ctx context.Context, aggregator *EventAggregator) error {
+	if c.store == nil {
+		return nil
+	}
+	orders, err := c.store.Orders(ctx)
+	if err != nil {
+		return err
+	}
+	checkpoints, from, err := c.store.Checkpoints(ctx)
+	if err != nil {
+		return err
+	}
+	aggregator.Restore(orders)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.checkpoints = checkpoints
+	c.from = from
+	slog.Info("Analytics restored", "orders", len(orders))
+	return nil
+}
+
+// Processed records that msg, from an order topic, has been folded in,
+// changing order if not nil. It retries the store until the write succeeds,
+// so the checkpoint never passes an event that was not stored.
+func (c *AnalyticsCoverage) Processed(ctx context.Context, msg kafka.Message, order *OrderRecord) {
+	var lostBefore time.Time
+	c.mu.Lock()
+	if c.started[msg.Topic] == nil {
+		c.started[msg.Topic] = make(map[int]bool)
+	}
+	if !c.started[msg.Topic][msg.Partition] {
+		c.started[msg.Topic][msg.Partition] = true
+		if checkpoint := c.checkpoints[msg.Topic][msg.Partition]; msg.Offset > checkpoint {
+			lostBefore = msg.Time
+			if lostBefore.After(c.from) {
+				c.from = lostBefore
+			}
+			slog.WarnContext(ctx, "Order events were deleted by retention before being counted; analytics are incomplete before the first remaining event",
+				"topic", msg.Topic, "partition", msg.Partition, "first_offset", msg.Offset, "checkpoint", checkpoint, "covered_from", lostBefore)
+		}
+	}
+	c.mu.Unlock()
+
+	if c.store == nil {
+		return
+	}
+	for {
+		storeCtx, cancel := context.WithTimeout(context.Background(), analyticsStoreTimeout)
+		err := c.store.Save(storeCtx, msg, order, lostBefore)
+		cancel()
+		if err == nil {
+			return
+		}
+		slog.ErrorContext(ctx, "Error storing analytics", "topic", msg.Topic, "partition", msg.Partition, "offset", msg.Offset, "error", err)
+		time.Sleep(5 * time.Second)
+	}
+}
+
+// For returns the coverage of a range starting at from.
+func (c *AnalyticsCoverage) For(from time.Time) Coverage {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.from.IsZero() {
+		return Coverage{Complete: true}
+	}
+	coveredFrom := c.from
+	return Coverage{From: &coveredFrom, Complete: !from.Before(coveredFrom)}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+// auditSchema stores each entry as the JSON it was hashed from, so the hash
+// can be recomputed from exactly what was stored. The other columns are for
+// operators querying the table.
+var auditSchema = []string{
+	`CREATE TABLE IF NOT EXISTS admin_audit_log (
+		sequence  BIGINT PRIMARY KEY,
+		id        VARCHAR(64) NOT NULL,
+		hash      CHAR(64) NOT NULL,
+		entry     TEXT NOT NULL,
+		stored_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`,
+}
+
+// AuditStore persists the audit log in Postgres, one row per entry. Rows are
+// only ever inserted.
+type AuditStore struct {
+	db *sql.DB
+}
+
+func NewAuditStore(db *sql.DB) (*AuditStore, error) {
+	if err := migrate(db, auditSchema); err != nil {
+		return nil, fmt.Errorf("migrate audit schema: %w", err)
+	}
+	return &AuditStore{db: db}, nil
+}
+
+// Insert stores entry unless its sequence is taken, as when another replica
+// appended the same entry first, and returns the entry stored at that
+// sequence.
+func (s *AuditStore) Insert(ctx context.Context, entry AdminLog) (AdminLog, error) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return AdminLog{}, err
+	}
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO admin_audit_log (sequence, id, hash, entry)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (sequence) DO NOTHING`,
+		entry.Sequence, entry.ID, entry.Hash, string(data))
+	if err != nil {
+		return AdminLog{}, fmt.Errorf("insert audit log entry %d: %w", entry.Sequence, err)
+	}
+
+	var stored string
+	row := s.db.QueryRowContext(ctx, `SELECT entry FROM admin_audit_log WHERE sequence = $1`, entry.Sequence)
+	if err := row.Scan(&stored); err != nil {
+		return AdminLog{}, fmt.Errorf("read audit log entry %d: %w", entry.Sequence, err)
+	}
+	var existing AdminLog
+	if err := json.Unmarshal([]byte(stored), &existing); err != nil {
+		return AdminLog{}, fmt.Errorf("decode audit log entry %d: %w", entry.Sequence, err)
+	}
+	return existing, nil
+}
+
+// Entries returns every stored entry in sequence order, decoded from the
+// stored JSON. A row that cannot be decoded is an error, as the log cannot be
+// read past it.
+func (s *AuditStore) Entries(ctx context.Context) ([]AdminLog, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT sequence, entry FROM admin_audit_log ORDER BY sequence`)
+	if err != nil {
+		return nil, fmt.Errorf("read audit log: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []AdminLog{}
+	for rows.Next() {
+		var sequence int64
+		var data string
+		if err := rows.Scan(&sequence, &data); err != nil {
+			return nil, fmt.Errorf("read audit log: %w", err)
+		}
+		var entry AdminLog
+		if err := json.Unmarshal([]byte(data), &entry); err != nil {
+			return nil, fmt.Errorf("decode audit log entry %d: %w", sequence, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
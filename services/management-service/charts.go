@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// ChartDataset is one series of a chart, in the shape Chart.js expects.
+type ChartDataset struct {
+	Label           string    `json:"label"`
+	Data            []float64 `json:"data"`
+	BackgroundColor []string  `json:"backgroundColor,omitempty"`
+	BorderColor     []string  `json:"borderColor,omitempty"`
+}
+
+// Chart metrics selectable through the metric query parameter.
+var chartMetrics = map[string]struct {
+	label string
+	value func(stats *BucketStats) float64
+}{
+	"orders":       {"Orders", func(s *BucketStats) float64 { return float64(s.Orders) }},
+	"revenue":      {"Revenue", func(s *BucketStats) float64 { return s.Revenue }},
+	"aov":          {"Average Order Value", (*BucketStats).AvgOrderValue},
+	"failure_rate": {"Failure Rate (%)", (*BucketStats).FailureRate},
+}
+
+// chartPalette is cycled through for product breakdown datasets.
+var chartPalette = []string{
+	"54, 162, 235",
+	"255, 99, 132",
+	"75, 192, 192",
+	"255, 159, 64",
+	"153, 102, 255",
+	"255, 205, 86",
+	"201, 203, 207",
+	"46, 204, 113",
+}
+
+// maxChartProducts limits the datasets of a product breakdown; the remaining
+// products are folded into an "Other" dataset.
+const maxChartProducts = 8
+
+func newChartDataset(label string, data []float64, color int) ChartDataset {
+	rgb := chartPalette[color%len(chartPalette)]
+	return ChartDataset{
+		Label:           label,
+		Data:            data,
+		BackgroundColor: []string{fmt.Sprintf("rgba(%s, 0.2)", rgb)},
+		BorderColor:     []string{fmt.Sprintf("rgba(%s, 1)", rgb)},
+	}
+}
+
+// dashboardPeriod resolves a named period ending now to a range and the
+// granularity charts use for it by default.
+func dashboardPeriod(period string, now time.Time) (from, to time.Time, granularity Granularity, err error) {
+	to = now
+	today := Daily.Truncate(now)
+	switch period {
+	case "today":
+		return today, to, Hourly, nil
+	case "week":
+		return today.AddDate(0, 0, -6), to, Daily, nil
+	case "month":
+		return today.AddDate(0, 0, -29), to, Daily, nil
+	case "quarter":
+		return today.AddDate(0, 0, -89), to, Weekly, nil
+	case "year":
+		return today.AddDate(0, 0, -364), to, Monthly, nil
+	}
+	return from, to, granularity, fmt.Errorf("invalid period %q (use today, week, month, quarter or year)", period)
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	"shared/auth"
+	"shared/config"
+	"shared/kafkaconn"
+	"shared/logging"
+)
+
+type Config struct {
+	config.Common `yaml:",inline"`
+
+	// PublicURL is the base URL recipients use to download reports.
+	PublicURL   string            `yaml:"public_url" env:"MANAGEMENT_PUBLIC_URL"`
+	Services    ServicesConfig    `yaml:"services"`
+	Health      HealthConfig      `yaml:"health"`
+	ConsumerLag ConsumerLagConfig `yaml:"consumer_lag"`
+	Features    Features          `yaml:"features"`
+
+	// ServiceToken is the bearer token sent on calls that other services
+	// authorise, such as report delivery through notification-service.
+	ServiceToken string `yaml:"service_token" env:"SERVICE_TOKEN" secret:"true"`
+	// DatabaseURL selects the Postgres store for the audit log, report
+	// schedules and analytics; empty keeps them in memory only, so the audit
+	// log and analytics are rebuilt from the topics on every start and
+	// schedules are lost.
+	DatabaseURL string `yaml:"database_url" env:"DATABASE_URL" secret:"true"`
+}
+
+// ServicesConfig holds the base URLs of the services management-service
+// calls, and the timeout for calls other than health and lag polling.
+type ServicesConfig struct {
+	Timeout      time.Duration `yaml:"timeout" env:"SERVICE_TIMEOUT"`
+	Order        string        `yaml:"order" env:"ORDER_SERVICE_URL"`
+	Inventory    string        `yaml:"inventory" env:"INVENTORY_SERVICE_URL"`
+	Product      string        `yaml:"product" env:"PRODUCT_SERVICE_URL"`
+	Payment      string        `yaml:"payment" env:"PAYMENT_SERVICE_URL"`
+	Notification string        `yaml:"notification" env:"NOTIFICATION_SERVICE_URL"`
+	Shipping     string        `yaml:"shipping" env:"SHIPPING_SERVICE_URL"`
+	Status       string        `yaml:"status" env:"STATUS_SERVICE_URL"`
+}
+
+type HealthConfig struct {
+	PollInterval time.Duration `yaml:"poll_interval" env:"HEALTH_POLL_INTERVAL"`
+	Timeout      time.Duration `yaml:"timeout" env:"HEALTH_TIMEOUT"`
+	// Responses slower than SlowThreshold mark a service degraded.
+	SlowThreshold time.Duration `yaml:"slow_threshold" env:"HEALTH_SLOW_THRESHOLD"`
+	// Window is the rolling window uptime is computed over.
+	Window time.Duration `yaml:"window" env:"HEALTH_WINDOW"`
+}
+
+type ConsumerLagConfig struct {
+	// Threshold is the per-partition lag, in messages, that raises an alert.
+	Threshold int64 `yaml:"threshold" env:"CONSUMER_LAG_THRESHOLD"`
+	// StaleAfter is how long a partition with pending messages may go
+	// without progress before it is reported stalled.
+	StaleAfter time.Duration `yaml:"stale_after" env:"CONSUMER_STALE_AFTER"`
+}
+
+type Features struct {
+	ReportScheduler bool `yaml:"report_scheduler" env:"FEATURE_REPORT_SCHEDULER"`
+	HealthMonitor   bool `yaml:"health_monitor" env:"FEATURE_HEALTH_MONITOR"`
+	LagMonitor      bool `yaml:"lag_monitor" env:"FEATURE_LAG_MONITOR"`
+}
+
+func (c Config) Validate() error {
+	errs := []error{c.Common.Validate(), validateURL("public_url", c.PublicURL)}
+
+	services := reflect.ValueOf(c.Services)
+	for i := 0; i < services.NumField(); i++ {
+		if field := services.Type().Field(i); field.Type.Kind() == reflect.String {
+			errs = append(errs, validateURL("services."+field.Tag.Get("yaml"), services.Field(i).String()))
+		}
+	}
+
+	durations := map[string]time.Duration{
+		"services.timeout":         c.Services.Timeout,
+		"health.poll_interval":     c.Health.PollInterval,
+		"health.timeout":           c.Health.Timeout,
+		"health.slow_threshold":    c.Health.SlowThreshold,
+		"health.window":            c.Health.Window,
+		"consumer_lag.stale_after": c.ConsumerLag.StaleAfter,
+	}
+	for name, d := range durations {
+		if d <= 0 {
+			errs = append(errs, fmt.Errorf("%s %s must be positive", name, d))
+		}
+	}
+	if c.ConsumerLag.Threshold <= 0 {
+		errs = append(errs, fmt.Errorf("consumer_lag.threshold %d must be positive", c.ConsumerLag.Threshold))
+	}
+	return errors.Join(errs...)
+}
+
+func validateURL(name, value string) error {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%s %q is not an http(s) URL", name, value)
+	}
+	return nil
+}
+
+// cfg is initialised before any other package state that reads it, so an
+// invalid configuration stops the service before it touches Kafka.
+var cfg = loadConfig()
+
+// kafkaConn carries the broker, TLS and SASL settings to every Kafka client.
+var kafkaConn = kafkaconn.MustNew(cfg.Kafka)
+
+// authn validates the bearer tokens of API requests.
+var authn = auth.MustNew(cfg.Auth)
+
+func loadConfig() *Config {
+	logging.Init("management-service")
+
+	c := &Config{
+		Common:    config.Defaults("management-service", 8083),
+		PublicURL: "http://localhost:8083",
+		Services: ServicesConfig{
+			Timeout:      5 * time.Second,
+			Order:        "http://order-service:8080",
+			Inventory:    "http://inventory-service:8081",
+			Product:      "http://product-service:8082",
+			Payment:      "http://payment-service:8084",
+			Notification: "http://notification-service:8085",
+			Shipping:     "http://shipping-service:8086",
+			Status:       "http://status-service:8087",
+		},
+		Health: HealthConfig{
+			PollInterval:  15 * time.Second,
+			Timeout:       3 * time.Second,
+			SlowThreshold: time.Second,
+			Window:        24 * time.Hour,
+		},
+		ConsumerLag: ConsumerLagConfig{
+			Threshold:  1000,
+			StaleAfter: 5 * time.Minute,
+		},
+		Features: Features{
+			ReportScheduler: true,
+			HealthMonitor:   true,
+			LagMonitor:      true,
+		},
+	}
+	config.MustLoad(c)
+	c.PublicURL = strings.TrimRight(c.PublicURL, "/")
+	return c
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"shared/lag"
+)
+
+// consumerServices expose GET /consumer/lag. Their URLs come from
+// monitoredServices.
+var consumerServices = []string{
+	"inventory-service",
+	"payment-service",
+	"notification-service",
+	"shipping-service",
+	"status-service",
+}
+
+func serviceURL(name string) string {
+	for _, service := range monitoredServices {
+		if service.Name == name {
+			return service.URL
+		}
+	}
+	return ""
+}
+
+// partitionWatch is what LagMonitor remembers about one partition between
+// polls.
+type partitionWatch struct {
+	lastOffset int64
+	progressAt time.Time // last time the partition advanced or was caught up
+	lagging    bool
+	stalled    bool
+}
+
+// LagMonitor polls every consuming service's lag report and raises
+// SystemAlerts when a partition's lag or time without progress crosses the
+// thresholds, and again when it recovers.
+type LagMonitor struct {
+	threshold  int64
+	staleAfter time.Duration
+
+	mu       sync.RWMutex
+	reports  []lag.Report
+	watching map[string]*partitionWatch // service/topic/partition
+}
+
+func NewLagMonitor(threshold int64, staleAfter time.Duration) *LagMonitor {
+	return &LagMonitor{
+		threshold:  threshold,
+		staleAfter: staleAfter,
+		reports:    []lag.Report{},
+		watching:   make(map[string]*partitionWatch),
+	}
+}
+
+func (m *LagMonitor) Start() {
+	ticker := time.NewTicker(cfg.Health.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		m.Poll()
+		<-ticker.C
+	}
+}
+
+// Poll collects the reports of every consuming service, including this one.
+func (m *LagMonitor) Poll() {
+	reports := make([]lag.Report, len(consumerServices)+1)
+	var wg sync.WaitGroup
+	for i, name := range consumerServices {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			reports[i] = fetchLagReport(name)
+		}(i, name)
+	}
+	wg.Wait()
+	reports[len(consumerServices)] = lagTracker.Report(context.Background())
+
+	now := time.Now()
+	var alerts []SystemAlert
+	m.mu.Lock()
+	for _, report := range reports {
+		for _, partition := range report.Partitions {
+			alerts = append(alerts, m.observe(report.Service, partition, now)...)
+		}
+	}
+	m.reports = reports
+	m.mu.Unlock()
+
+	if len(alerts) > 0 {
+		mutex.Lock()
+		systemAlerts = append(systemAlerts, alerts...)
+		mutex.Unlock()
+	}
+}
+
+func fetchLagReport(name string) lag.Report {
+	report := lag.Report{Service: name, Partitions: []lag.PartitionLag{}, CheckedAt: time.Now()}
+
+	resp, err := healthClient.Get(serviceURL(name) + "/consumer/lag")
+	if err != nil {
+		report.Error = err.Error()
+		return report
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		report.Error = fmt.Sprintf("consumer lag returned %s", resp.Status)
+		return report
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		report.Error = fmt.Sprintf("decode consumer lag: %v", err)
+	}
+	return report
+}
+
+// observe updates the watch for one partition and returns the alerts its
+// transitions raise. Callers hold m.mu.
+func (m *LagMonitor) observe(service string, partition lag.PartitionLag, now time.Time) []SystemAlert {
+	key := fmt.Sprintf("%s/%s/%d", service, partition.Topic, partition.Partition)
+	watch, seen := m.watching[key]
+	if !seen {
+		watch = &partitionWatch{lastOffset: partition.LastOffset, progressAt: now}
+		if partition.LastProcessedAt != nil {
+			watch.progressAt = *partition.LastProcessedAt
+		}
+		m.watching[key] = watch
+	}
+	if partition.LastOffset != watch.lastOffset || partition.Lag == 0 {
+		watch.lastOffset = partition.LastOffset
+		watch.progressAt = now
+	}
+
+	where := fmt.Sprintf("%s[%d]", partition.Topic, partition.Partition)
+	var alerts []SystemAlert
+
+	lagging := partition.Lag >= m.threshold
+	if lagging && !watch.lagging {
+		alerts = append(alerts, newLagAlert("WARNING", "Consumer Lag Alert",
+			fmt.Sprintf("%s is %d messages behind on %s (threshold %d)", service, partition.Lag, where, m.threshold)))
+	}
+
+	idle := now.Sub(watch.progressAt)
+	stalled := partition.Lag > 0 && idle >= m.staleAfter
+	if stalled && !watch.stalled {
+		alerts = append(alerts, newLagAlert("ERROR", "Consumer Stalled",
+			fmt.Sprintf("%s has not made progress on %s for %s with %d messages waiting",
+				service, where, idle.Round(time.Second), partition.Lag)))
+	}
+
+	if (watch.lagging || watch.stalled) && !lagging && !stalled {
+		alerts = append(alerts, newLagAlert("SUCCESS", "Consumer Lag Recovered",
+			fmt.Sprintf("%s has caught up on %s (%d messages behind)", service, where, partition.Lag)))
+	}
+	watch.lagging = lagging
+	watch.stalled = stalled
+	return alerts
+}
+
+func newLagAlert(alertType, title, message string) SystemAlert {
+	level := slog.LevelInfo
+	switch alertType {
+	case "WARNING":
+		level = slog.LevelWarn
+	case "ERROR":
+		level = slog.LevelError
+	}
+	slog.Log(context.Background(), level, title, "message", message)
+	return SystemAlert{
+		ID:        uuid.New().String(),
+		Type:      alertType,
+		Title:     title,
+		Message:   message,
+		CreatedAt: time.Now(),
+	}
+}
+
+// Reports returns the latest report of every consuming service.
+func (m *LagMonitor) Reports() []lag.Report {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]lag.Report(nil), m.reports...)
+}
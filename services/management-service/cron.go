@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CronExpression is a standard five-field cron expression (minute, hour, day
+// of month, month, day of week) evaluated in UTC. Fields accept "*", single
+// values, ranges ("1-5"), steps ("*/15", "0-30/10") and comma-separated lists.
+// Day of week runs 0-6 from Sunday; 7 is also Sunday. As in cron, when both
+// day fields are restricted a day matches if either does.
+type CronExpression struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+}
+
+var cronMacros = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+// How far ahead Next searches before giving up on an expression that never
+// matches (e.g. "0 0 31 2 *").
+const cronSearchDays = 5 * 366
+
+func ParseCron(expr string) (*CronExpression, error) {
+	if macro, ok := cronMacros[strings.TrimSpace(expr)]; ok {
+		expr = macro
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q must have 5 fields", expr)
+	}
+
+	var cron CronExpression
+	var err error
+	if cron.minute, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("minute: %w", err)
+	}
+	if cron.hour, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("hour: %w", err)
+	}
+	if cron.dom, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("day of month: %w", err)
+	}
+	if cron.month, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("month: %w", err)
+	}
+	if cron.dow, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, fmt.Errorf("day of week: %w", err)
+	}
+	if cron.dow&(1<<7) != 0 {
+		cron.dow |= 1 // 7 is Sunday
+	}
+	cron.domAny = fields[2] == "*"
+	cron.dowAny = fields[4] == "*"
+
+	if cron.Next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("cron expression %q never matches", expr)
+	}
+	return &cron, nil
+}
+
+// parseCronField returns a bitset of the values a field matches.
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			rangePart = part[:i]
+		}
+
+		lo, hi := min, max
+		if rangePart != "*" {
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid value %q", part)
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("invalid value %q", part)
+				}
+			} else if step > 1 {
+				hi = max // "5/15" means every 15 starting at 5
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q out of range %d-%d", part, min, max)
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (c *CronExpression) matchesDay(t time.Time) bool {
+	if c.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+	domMatch := c.dom&(1<<uint(t.Day())) != 0
+	dowMatch := c.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case c.domAny && c.dowAny:
+		return true
+	case c.domAny:
+		return dowMatch
+	case c.dowAny:
+		return domMatch
+	default:
+		return domMatch || dowMatch
+	}
+}
+
+// Next returns the first matching minute strictly after after, or the zero
+// time if there is none within cronSearchDays.
+func (c *CronExpression) Next(after time.Time) time.Time {
+	t := after.UTC().Truncate(time.Minute).Add(time.Minute)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < cronSearchDays; i++ {
+		if c.matchesDay(day) {
+			for hour := 0; hour < 24; hour++ {
+				if c.hour&(1<<uint(hour)) == 0 {
+					continue
+				}
+				for minute := 0; minute < 60; minute++ {
+					if c.minute&(1<<uint(minute)) == 0 {
+						continue
+					}
+					candidate := day.Add(time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute)
+					if !candidate.Before(t) {
+						return candidate
+					}
+				}
+			}
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+	return time.Time{}
+}
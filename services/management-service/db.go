@@ -0,0 +1,36 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+
+	_ "github.com/lib/pq"
+)
+
+// openDatabase connects to the Postgres database the audit log and report
+// schedules are stored in. It returns nil when no database URL is set, in
+// which case both are kept in memory.
+func openDatabase() (*sql.DB, error) {
+	if cfg.DatabaseURL == "" {
+		return nil, nil
+	}
+	db, err := sql.Open("postgres", cfg.DatabaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("open postgres: %w", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("connect to postgres: %w", err)
+	}
+	return db, nil
+}
+
+// migrate creates the tables in schema that do not exist yet.
+func migrate(db *sql.DB, schema []string) error {
+	for _, stmt := range schema {
+		if _, err := db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Topics management-service builds its metrics and audit log from.
+var consumedTopics = []string{
+	cfg.Kafka.Topics.Orders,
+	cfg.Kafka.Topics.Inventory,
+	cfg.Kafka.Topics.Payment,
+	cfg.Kafka.Topics.Shipping,
+	cfg.Kafka.Topics.Audit,
+}
+
+// Order lifecycle statuses, matching status-service.
+const (
+	StatusCreated            = "created"
+	StatusInventoryConfirmed = "inventory_confirmed"
+	StatusInventoryRejected  = "inventory_rejected"
+	StatusPaymentCompleted   = "payment_completed"
+	StatusPaymentFailed      = "payment_failed"
+	StatusShipped            = "shipped"
+)
+
+// eventStatuses maps event types to the status they move an order to.
+var eventStatuses = map[string]string{
+	"OrderCreated":       StatusCreated,
+	"InventoryConfirmed": StatusInventoryConfirmed,
+	"InventoryRejected":  StatusInventoryRejected,
+	"PaymentCompleted":   StatusPaymentCompleted,
+	"PaymentFailed":      StatusPaymentFailed,
+	"Shipped":            StatusShipped,
+}
+
+// statusRank orders statuses by lifecycle stage. Topics are consumed
+// independently, so an order only moves to a status of a later stage.
+var statusRank = map[string]int{
+	StatusCreated:            0,
+	StatusInventoryConfirmed: 1,
+	StatusInventoryRejected:  1,
+	StatusPaymentCompleted:   2,
+	StatusPaymentFailed:      2,
+	StatusShipped:            3,
+}
+
+// isTerminal reports whether no further events are expected for status.
+func isTerminal(status string) bool {
+	return status == StatusShipped || status == StatusInventoryRejected || status == StatusPaymentFailed
+}
+
+// eventTimeFields are the payload fields producers use for the time an event
+// happened, in order of preference.
+var eventTimeFields = []string{"processed_at", "shipped_at", "timestamp"}
+
+// OrderRecord is management-service's view of a single order, folded from
+// every event seen for it.
+type OrderRecord struct {
+	OrderID    string    `json:"order_id"`
+	ProductID  string    `json:"product_id"`
+	CustomerID string    `json:"customer_id,omitempty"`
+	Quantity   int       `json:"quantity"`
+	Status     string    `json:"status"`
+	Amount     float64   `json:"amount"`
+	CreatedAt  time.Time `json:"created_at"`
+	PaidAt     time.Time `json:"paid_at,omitempty"`
+	UpdatedAt  time.Time `json:"updated_at"`
+
+	facts []orderFact
+}
+
+// EventAggregator folds order lifecycle events into per-order records.
+// Applying the same event twice leaves the records unchanged, so replaying
+// topics from the beginning is always safe. Every change is also rolled into
+// the analytics store.
+type EventAggregator struct {
+	mu              sync.RWMutex
+	orders          map[string]*OrderRecord
+	analytics       *AnalyticsStore
+	eventsProcessed int64
+	lastEventAt     time.Time
+}
+
+func NewEventAggregator(analytics *AnalyticsStore) *EventAggregator {
+	return &EventAggregator{
+		orders:    make(map[string]*OrderRecord),
+		analytics: analytics,
+	}
+}
+
+// Apply folds a Kafka message into the aggregate and returns a copy of the
+// order it changed, or nil for a redelivered event. ok is false for messages
+// that are not order events.
+func (a *EventAggregator) Apply(msg kafka.Message) (changed *OrderRecord, ok bool) {
+	var data map[string]interface{}
+	if err := json.Unmarshal(msg.Value, &data); err != nil {
+		return nil, false
+	}
+	orderID, _ := data["order_id"].(string)
+	eventType, _ := data["event_type"].(string)
+	status, known := eventStatuses[eventType]
+	if orderID == "" || !known {
+		return nil, false
+	}
+
+	occurredAt := msg.Time
+	for _, field := range eventTimeFields {
+		if value, ok := data[field].(string); ok {
+			if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+				occurredAt = t
+				break
+			}
+		}
+	}
+	if occurredAt.IsZero() {
+		occurredAt = time.Now()
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	order, exists := a.orders[orderID]
+	if !exists {
+		order = &OrderRecord{OrderID: orderID, Status: StatusCreated, CreatedAt: occurredAt}
+		a.orders[orderID] = order
+	}
+
+	// Each event type happens at most once per order; anything else is a
+	// redelivery.
+	for _, fact := range order.facts {
+		if fact.EventType == eventType {
+			return nil, true
+		}
+	}
+	fact := orderFact{EventType: eventType, At: occurredAt}
+
+	if productID, ok := data["product_id"].(string); ok && productID != "" && (order.ProductID == "" || eventType == "OrderCreated") {
+		order.ProductID = productID
+	}
+	if quantity, ok := data["quantity"].(float64); ok && quantity > 0 && (order.Quantity == 0 || eventType == "OrderCreated") {
+		order.Quantity = int(quantity)
+	}
+	if customerID, ok := data["customer_id"].(string); ok && customerID != "" {
+		order.CustomerID = customerID
+	}
+
+	switch eventType {
+	case "OrderCreated":
+		order.CreatedAt = occurredAt
+	case "PaymentCompleted":
+		if amount, ok := data["amount"].(float64); ok {
+			order.Amount = amount
+			fact.Amount = amount
+		}
+		order.PaidAt = occurredAt
+	}
+
+	if statusRank[status] > statusRank[order.Status] {
+		order.Status = status
+	}
+	if occurredAt.After(order.UpdatedAt) {
+		order.UpdatedAt = occurredAt
+	}
+	order.facts = append(order.facts, fact)
+	a.analytics.Record(order.OrderID, order.ProductID, order.Quantity, order.facts)
+
+	a.eventsProcessed++
+	if occurredAt.After(a.lastEventAt) {
+		a.lastEventAt = occurredAt
+	}
+	changed = copyOrderRecord(order)
+	return changed, true
+}
+
+// Restore adds orders folded before this start, as stored, to the aggregate.
+// Events for them replayed from the topics are then redeliveries.
+func (a *EventAggregator) Restore(orders []OrderRecord) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for i := range orders {
+		order := copyOrderRecord(&orders[i])
+		a.orders[order.OrderID] = order
+		a.analytics.Record(order.OrderID, order.ProductID, order.Quantity, order.facts)
+	}
+}
+
+func copyOrderRecord(order *OrderRecord) *OrderRecord {
+	orderCopy := *order
+	orderCopy.facts = append([]orderFact(nil), order.facts...)
+	return &orderCopy
+}
+
+// Metrics computes order and revenue metrics as of now. Product and stock
+// counts come from inventory-service and are filled in by the caller.
+func (a *EventAggregator) Metrics(now time.Time) SystemMetrics {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	metrics := SystemMetrics{Timestamp: now}
+	for _, order := range a.orders {
+		metrics.TotalOrders++
+		if !order.CreatedAt.Before(startOfDay) {
+			metrics.TodayOrders++
+		}
+		if order.Status == StatusPaymentCompleted || order.Status == StatusShipped {
+			metrics.TotalRevenue += order.Amount
+			if !order.PaidAt.Before(startOfDay) {
+				metrics.TodayRevenue += order.Amount
+			}
+		}
+		switch {
+		case order.Status == StatusShipped:
+			metrics.CompletedOrders++
+		case !isTerminal(order.Status):
+			metrics.PendingOrders++
+		}
+	}
+	return metrics
+}
+
+// Orders returns copies of every order record.
+func (a *EventAggregator) Orders() []OrderRecord {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	orders := make([]OrderRecord, 0, len(a.orders))
+	for _, order := range a.orders {
+		orders = append(orders, *order)
+	}
+	return orders
+}
+
+// Stats returns how many events have been applied and when the latest one
+// happened.
+func (a *EventAggregator) Stats() (eventsProcessed int64, lastEventAt time.Time) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.eventsProcessed, a.lastEventAt
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// monitoredService is a service whose /health endpoint management-service
+// polls.
+type monitoredService struct {
+	Name string
+	URL  string
+}
+
+var monitoredServices = []monitoredService{
+	{"order-service", cfg.Services.Order},
+	{"inventory-service", cfg.Services.Inventory},
+	{"product-service", cfg.Services.Product},
+	{"payment-service", cfg.Services.Payment},
+	{"notification-service", cfg.Services.Notification},
+	{"shipping-service", cfg.Services.Shipping},
+	{"status-service", cfg.Services.Status},
+}
+
+var healthClient = &http.Client{Timeout: cfg.Health.Timeout}
+
+type healthProbe struct {
+	At      time.Time
+	Up      bool
+	Latency time.Duration
+}
+
+// ServiceHealth is the current health of one service.
+type ServiceHealth struct {
+	Name                string     `json:"name"`
+	URL                 string     `json:"url"`
+	Status              string     `json:"status"` // healthy, degraded, unhealthy, unknown
+	Reported            string     `json:"reported_status,omitempty"`
+	Uptime              float64    `json:"uptime"` // percent of probes up within the window
+	UptimeWindow        string     `json:"uptime_window"`
+	Checks              int        `json:"checks"`
+	LatencyMs           float64    `json:"latency_ms"`
+	AvgLatencyMs        float64    `json:"avg_latency_ms"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastChecked         *time.Time `json:"last_checked,omitempty"`
+	LastUp              *time.Time `json:"last_up,omitempty"`
+}
+
+type serviceHealthState struct {
+	health ServiceHealth
+	probes []healthProbe
+}
+
+// HealthMonitor polls every monitored service and keeps the probes within
+// the rolling window.
+type HealthMonitor struct {
+	mu       sync.RWMutex
+	window   time.Duration
+	services map[string]*serviceHealthState
+}
+
+func NewHealthMonitor(window time.Duration) *HealthMonitor {
+	m := &HealthMonitor{
+		window:   window,
+		services: make(map[string]*serviceHealthState),
+	}
+	for _, service := range monitoredServices {
+		m.services[service.Name] = &serviceHealthState{
+			health: ServiceHealth{
+				Name:         service.Name,
+				URL:          service.URL,
+				Status:       "unknown",
+				UptimeWindow: window.String(),
+			},
+		}
+	}
+	return m
+}
+
+// Start polls all services now and then every health poll interval.
+func (m *HealthMonitor) Start() {
+	ticker := time.NewTicker(cfg.Health.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		m.PollAll()
+		<-ticker.C
+	}
+}
+
+// PollAll probes every service concurrently and waits for the results.
+func (m *HealthMonitor) PollAll() {
+	var wg sync.WaitGroup
+	for _, service := range monitoredServices {
+		wg.Add(1)
+		go func(service monitoredService) {
+			defer wg.Done()
+			m.record(service, probeService(service))
+		}(service)
+	}
+	wg.Wait()
+}
+
+type probeResult struct {
+	healthProbe
+	Reported string
+	Err      error
+}
+
+// probeService calls GET /health. A service is up if it answers 200.
+func probeService(service monitoredService) probeResult {
+	start := time.Now()
+	resp, err := healthClient.Get(service.URL + "/health")
+	result := probeResult{healthProbe: healthProbe{At: start, Latency: time.Since(start)}}
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Status string `json:"status"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if json.Unmarshal(data, &body) == nil {
+		result.Reported = body.Status
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		result.Err = fmt.Errorf("health check returned %s", resp.Status)
+		return result
+	}
+	result.Up = true
+	return result
+}
+
+func (m *HealthMonitor) record(service monitoredService, result probeResult) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state := m.services[service.Name]
+	state.probes = append(state.probes, result.healthProbe)
+	cutoff := result.At.Add(-m.window)
+	drop := 0
+	for drop < len(state.probes) && state.probes[drop].At.Before(cutoff) {
+		drop++
+	}
+	state.probes = state.probes[drop:]
+
+	h := &state.health
+	h.URL = service.URL
+	at := result.At
+	h.LastChecked = &at
+	h.Reported = result.Reported
+	h.LatencyMs = float64(result.Latency) / float64(time.Millisecond)
+
+	if result.Up {
+		h.ConsecutiveFailures = 0
+		h.LastError = ""
+		h.LastUp = &at
+		h.Status = "healthy"
+		if result.Latency > cfg.Health.SlowThreshold || (result.Reported != "" && result.Reported != "healthy") {
+			h.Status = "degraded"
+		}
+	} else {
+		h.ConsecutiveFailures++
+		h.LastError = result.Err.Error()
+		h.Status = "unhealthy"
+		if h.ConsecutiveFailures == 1 {
+			slog.Warn("Health check failed", "target", service.Name, "error", result.Err)
+		}
+	}
+
+	up := 0
+	var latency time.Duration
+	for _, probe := range state.probes {
+		if probe.Up {
+			up++
+			latency += probe.Latency
+		}
+	}
+	h.Checks = len(state.probes)
+	h.Uptime = 100 * float64(up) / float64(len(state.probes))
+	h.AvgLatencyMs = 0
+	if up > 0 {
+		h.AvgLatencyMs = float64(latency) / float64(up) / float64(time.Millisecond)
+	}
+}
+
+// Services returns the health of every monitored service plus
+// management-service itself, in monitoredServices order.
+func (m *HealthMonitor) Services() []ServiceHealth {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	services := make([]ServiceHealth, 0, len(monitoredServices)+1)
+	for _, service := range monitoredServices {
+		services = append(services, m.services[service.Name].health)
+	}
+
+	// This process is answering the request, so it is up for as long as it
+	// has been running.
+	now := time.Now()
+	services = append(services, ServiceHealth{
+		Name:         "management-service",
+		Status:       "healthy",
+		Reported:     "healthy",
+		Uptime:       100,
+		UptimeWindow: m.window.String(),
+		LastChecked:  &now,
+		LastUp:       &now,
+	})
+	return services
+}
+
+// overallStatus is unhealthy when Kafka or every service is down, degraded
+// when anything is not healthy, and healthy otherwise.
+func overallStatus(services []ServiceHealth, kafka KafkaHealth) string {
+	if kafka.Status == "unhealthy" {
+		return "unhealthy"
+	}
+	down, notHealthy := 0, 0
+	for _, service := range services {
+		if service.Status == "unhealthy" {
+			down++
+		}
+		if service.Status != "healthy" {
+			notHealthy++
+		}
+	}
+	switch {
+	case down == len(services)-1: // everything but management-service
+		return "unhealthy"
+	case notHealthy > 0 || kafka.Status != "healthy":
+		return "degraded"
+	default:
+		return "healthy"
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// InventoryProduct is a product as reported by inventory-service.
+type InventoryProduct struct {
+	ID         string  `json:"id"`
+	Name       string  `json:"name"`
+	Stock      int     `json:"stock"`
+	AlertLevel int     `json:"alert_level"`
+	Category   string  `json:"category"`
+	Price      float64 `json:"price"`
+}
+
+// IsLowStock uses the same rule as inventory-service's low-stock alerts.
+func (p InventoryProduct) IsLowStock() bool {
+	return p.Stock <= p.AlertLevel
+}
+
+var serviceClient = &http.Client{Timeout: cfg.Services.Timeout}
+
+// fetchInventoryProducts loads the current stock levels from inventory-service.
+// Stock levels are not carried on the inventory topic, so they are polled.
+func fetchInventoryProducts() ([]InventoryProduct, error) {
+	resp, err := serviceClient.Get(cfg.Services.Inventory + "/products")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("inventory-service returned %s", resp.Status)
+	}
+
+	var body struct {
+		Products []InventoryProduct `json:"products"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("decode inventory products: %w", err)
+	}
+	return body.Products, nil
+}
+
+// InventoryMovement is a stock change recorded by inventory-service.
+type InventoryMovement struct {
+	ID        string `json:"id"`
+	ProductID string `json:"product_id"`
+	Action    string `json:"action"` // added, increased, decreased, reserved, alert_updated
+	Quantity  int    `json:"quantity"`
+	Reason    string `json:"reason"`
+	Timestamp string `json:"timestamp"`
+}
+
+// fetchInventoryHistory loads the recent stock movements from inventory-service.
+func fetchInventoryHistory() ([]InventoryMovement, error) {
+	resp, err := serviceClient.Get(cfg.Services.Inventory + "/history")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("inventory-service returned %s", resp.Status)
+	}
+
+	var body struct {
+		History []InventoryMovement `json:"history"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("decode inventory history: %w", err)
+	}
+	return body.History, nil
+}
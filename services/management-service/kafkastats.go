@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const kafkaStatsTimeout = 5 * time.Second
+
+// TopicStats describes one topic at the last poll.
+type TopicStats struct {
+	Name           string  `json:"name"`
+	Partitions     int     `json:"partitions"`
+	Messages       int64   `json:"messages"` // retained messages across partitions
+	MessagesPerSec float64 `json:"messages_per_sec"`
+}
+
+// ConsumerGroupLag is how far a consumer group's committed offsets trail the
+// end of the topics it consumes.
+type ConsumerGroupLag struct {
+	GroupID string           `json:"group_id"`
+	Lag     int64            `json:"lag"`
+	Topics  map[string]int64 `json:"topics"` // lag per topic
+}
+
+// KafkaHealth is the broker's state and traffic at the last poll.
+type KafkaHealth struct {
+	Status         string             `json:"status"` // healthy, degraded, unhealthy, unknown
+	Broker         string             `json:"broker"`
+	Brokers        int                `json:"brokers"`
+	Topics         int                `json:"topics"`
+	TopicStats     []TopicStats       `json:"topic_stats"`
+	MessagesPerSec float64            `json:"messages_per_sec"`
+	ConsumerLag    int64              `json:"consumer_lag"` // total across groups
+	ConsumerGroups []ConsumerGroupLag `json:"consumer_groups"`
+	LatencyMs      float64            `json:"latency_ms"`
+	LastError      string             `json:"last_error,omitempty"`
+	LastChecked    time.Time          `json:"last_checked,omitempty"`
+}
+
+// KafkaMonitor polls the cluster for topics, end offsets and consumer group
+// offsets. Throughput is the growth of end offsets between two polls.
+type KafkaMonitor struct {
+	mu         sync.RWMutex
+	health     KafkaHealth
+	lastOffset map[string]int64 // end offset sum per topic at the last poll
+	lastPoll   time.Time
+}
+
+func NewKafkaMonitor() *KafkaMonitor {
+	return &KafkaMonitor{
+		health: KafkaHealth{
+			Status:         "unknown",
+			Broker:         strings.Join(cfg.Kafka.Brokers, ","),
+			TopicStats:     []TopicStats{},
+			ConsumerGroups: []ConsumerGroupLag{},
+		},
+	}
+}
+
+func (m *KafkaMonitor) Start() {
+	ticker := time.NewTicker(cfg.Health.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		m.Poll()
+		<-ticker.C
+	}
+}
+
+func (m *KafkaMonitor) Health() KafkaHealth {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.health
+}
+
+// Poll refreshes the cluster figures. A broker that cannot be reached marks
+// Kafka unhealthy; failing to read group offsets only degrades it.
+func (m *KafkaMonitor) Poll() {
+	ctx, cancel := context.WithTimeout(context.Background(), kafkaStatsTimeout)
+	defer cancel()
+
+	client := kafkaConn.Client(kafkaStatsTimeout)
+	start := time.Now()
+
+	health := KafkaHealth{
+		Status:         "healthy",
+		Broker:         strings.Join(cfg.Kafka.Brokers, ","),
+		TopicStats:     []TopicStats{},
+		ConsumerGroups: []ConsumerGroupLag{},
+		LastChecked:    start,
+	}
+
+	endOffsets, partitions, brokers, err := fetchEndOffsets(ctx, client)
+	health.LatencyMs = float64(time.Since(start)) / float64(time.Millisecond)
+	if err != nil {
+		health.Status = "unhealthy"
+		health.LastError = err.Error()
+		m.mu.Lock()
+		if m.health.Status != "unhealthy" {
+			slog.Warn("Kafka health check failed", "error", err)
+		}
+		m.health = health
+		m.mu.Unlock()
+		return
+	}
+	health.Brokers = brokers
+	health.Topics = len(partitions)
+
+	groups, err := fetchConsumerLag(ctx, client, endOffsets)
+	if err != nil {
+		health.Status = "degraded"
+		health.LastError = err.Error()
+	}
+	for _, group := range groups {
+		health.ConsumerLag += group.Lag
+	}
+	health.ConsumerGroups = groups
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	elapsed := start.Sub(m.lastPoll).Seconds()
+	totals := make(map[string]int64, len(endOffsets))
+	for topic, offsets := range endOffsets {
+		stats := TopicStats{Name: topic, Partitions: partitions[topic]}
+		for _, offset := range offsets {
+			totals[topic] += offset.LastOffset
+			stats.Messages += offset.LastOffset - offset.FirstOffset
+		}
+		if previous, seen := m.lastOffset[topic]; seen && elapsed > 0 && totals[topic] >= previous {
+			stats.MessagesPerSec = float64(totals[topic]-previous) / elapsed
+		}
+		health.MessagesPerSec += stats.MessagesPerSec
+		health.TopicStats = append(health.TopicStats, stats)
+	}
+	sort.Slice(health.TopicStats, func(i, j int) bool { return health.TopicStats[i].Name < health.TopicStats[j].Name })
+
+	m.lastOffset = totals
+	m.lastPoll = start
+	m.health = health
+}
+
+// fetchEndOffsets returns the first and last offset of every partition of
+// every non-internal topic, the partition count per topic and the number of
+// brokers.
+func fetchEndOffsets(ctx context.Context, client *kafka.Client) (map[string][]kafka.PartitionOffsets, map[string]int, int, error) {
+	metadata, err := client.Metadata(ctx, &kafka.MetadataRequest{})
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("read metadata: %w", err)
+	}
+
+	partitions := make(map[string]int)
+	requests := make(map[string][]kafka.OffsetRequest)
+	for _, topic := range metadata.Topics {
+		if topic.Internal || strings.HasPrefix(topic.Name, "__") || topic.Error != nil {
+			continue
+		}
+		partitions[topic.Name] = len(topic.Partitions)
+		for _, partition := range topic.Partitions {
+			requests[topic.Name] = append(requests[topic.Name],
+				kafka.FirstOffsetOf(partition.ID), kafka.LastOffsetOf(partition.ID))
+		}
+	}
+	if len(requests) == 0 {
+		return map[string][]kafka.PartitionOffsets{}, partitions, len(metadata.Brokers), nil
+	}
+
+	offsets, err := client.ListOffsets(ctx, &kafka.ListOffsetsRequest{Topics: requests})
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("list offsets: %w", err)
+	}
+	return offsets.Topics, partitions, len(metadata.Brokers), nil
+}
+
+// fetchConsumerLag computes the lag of every consumer group with committed
+// offsets. Partitions a group has never committed are not counted.
+func fetchConsumerLag(ctx context.Context, client *kafka.Client, endOffsets map[string][]kafka.PartitionOffsets) ([]ConsumerGroupLag, error) {
+	listed, err := client.ListGroups(ctx, &kafka.ListGroupsRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("list consumer groups: %w", err)
+	}
+	if listed.Error != nil {
+		return nil, fmt.Errorf("list consumer groups: %w", listed.Error)
+	}
+
+	ends := make(map[string]map[int]int64)
+	for topic, offsets := range endOffsets {
+		ends[topic] = make(map[int]int64)
+		for _, offset := range offsets {
+			ends[topic][offset.Partition] = offset.LastOffset
+		}
+	}
+
+	groups := make([]ConsumerGroupLag, 0, len(listed.Groups))
+	var firstErr error
+	for _, listedGroup := range listed.Groups {
+		committed, err := client.OffsetFetch(ctx, &kafka.OffsetFetchRequest{GroupID: listedGroup.GroupID})
+		if err == nil {
+			err = committed.Error
+		}
+		if err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("fetch offsets for group %s: %w", listedGroup.GroupID, err)
+			}
+			continue
+		}
+
+		group := ConsumerGroupLag{GroupID: listedGroup.GroupID, Topics: make(map[string]int64)}
+		for topic, partitions := range committed.Topics {
+			for _, partition := range partitions {
+				end, known := ends[topic][partition.Partition]
+				if !known || partition.Error != nil || partition.CommittedOffset < 0 {
+					continue
+				}
+				if lag := end - partition.CommittedOffset; lag > 0 {
+					group.Topics[topic] += lag
+					group.Lag += lag
+				} else if _, seen := group.Topics[topic]; !seen {
+					group.Topics[topic] = 0
+				}
+			}
+		}
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].GroupID < groups[j].GroupID })
+	return groups, firstErr
+}
@@ -1,15 +1,24 @@
 package main
 
 import (
-	"log"
-	"math/rand"
+	"context"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"os"
 	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/segmentio/kafka-go"
+
+	"shared/config"
+	"shared/health"
+	"shared/lag"
+	"shared/logging"
+	"shared/metrics"
+	"shared/tracing"
 )
 
 // Dashboard metrics
@@ -19,6 +28,7 @@ type DashboardMetrics struct {
 	LowStockProducts int     `json:"low_stock_products"`
 	PendingOrders    int     `json:"pending_orders"`
 	Timestamp        time.Time `json:"timestamp"`
+	Coverage         Coverage  `json:"coverage"`
 }
 
 // System metrics
@@ -44,13 +54,9 @@ type RevenueAnalytics struct {
 
 // Chart data structure
 type ChartData struct {
-	Labels   []string `json:"labels"`
-	Datasets []struct {
-		Label           string    `json:"label"`
-		Data            []float64 `json:"data"`
-		BackgroundColor []string  `json:"backgroundColor,omitempty"`
-		BorderColor     []string  `json:"borderColor,omitempty"`
-	} `json:"datasets"`
+	Labels   []string       `json:"labels"`
+	Datasets []ChartDataset `json:"datasets"`
+	Coverage Coverage       `json:"coverage"`
 }
 
 // System alert
@@ -63,117 +69,204 @@ type SystemAlert struct {
 	IsRead    bool      `json:"is_read"`
 }
 
-// Admin log entry
-type AdminLog struct {
-	ID        string                 `json:"id"`
-	AdminID   string                 `json:"admin_id"`
-	Action    string                 `json:"action"`
-	Resource  string                 `json:"resource"`
-	Details   map[string]interface{} `json:"details"`
-	IPAddress string                 `json:"ip_address"`
-	Timestamp time.Time              `json:"timestamp"`
-}
-
 // Report generation request
 type ReportRequest struct {
 	Type      string    `json:"type"`      // sales, inventory, orders
 	StartDate time.Time `json:"start_date"`
 	EndDate   time.Time `json:"end_date"`
-	Format    string    `json:"format"`    // json, csv, pdf
+	Format    string    `json:"format"`    // json, csv, xlsx, pdf
 }
 
 // Generated report
 type Report struct {
 	ID          string      `json:"id"`
 	Type        string      `json:"type"`
+	Format      string      `json:"format"`
 	Status      string      `json:"status"` // generating, completed, failed
+	StartDate   time.Time   `json:"start_date"`
+	EndDate     time.Time   `json:"end_date"`
 	Data        interface{} `json:"data,omitempty"`
+	Error       string      `json:"error,omitempty"`
+	DownloadURL string      `json:"download_url,omitempty"`
 	GeneratedAt time.Time   `json:"generated_at"`
 	ExpiresAt   time.Time   `json:"expires_at"`
 }
 
 // In-memory storage
 var (
-	systemMetrics  = SystemMetrics{}
-	systemAlerts   = []SystemAlert{}
-	adminLogs      = []AdminLog{}
-	reports        = make(map[string]Report)
-	mutex          = sync.RWMutex{}
+	systemMetrics     = SystemMetrics{}
+	systemAlerts      = []SystemAlert{}
+	reports           = make(map[string]Report)
+	reportFiles       = make(map[string]*ReportFile)
+	inventoryProducts = []InventoryProduct{}
+	lowStockProducts  = make(map[string]bool)
+	mutex             = sync.RWMutex{}
+)
+
+// Aggregated order state and time-bucketed analytics built from the consumed
+// topics
+var (
+	analytics  = NewAnalyticsStore()
+	aggregator = NewEventAggregator(analytics)
+)
+
+// Live health of the other services and the Kafka cluster
+var (
+	healthMonitor = NewHealthMonitor(cfg.Health.Window)
+	kafkaMonitor  = NewKafkaMonitor()
+	lagTracker    = lag.NewTracker("management-service", cfg.Kafka.GroupID, kafkaConn, consumedTopics...)
+	lagMonitor    = NewLagMonitor(cfg.ConsumerLag.Threshold, cfg.ConsumerLag.StaleAfter)
 )
 
-// Kafka configuration
-const kafkaBroker = "kafka:9092"
+// healthChecker backs /health, /health/live and /health/ready.
+var healthChecker = health.New("management-service")
 
-// Kafka reader for consuming events
-var kafkaReader *kafka.Reader
+// replay tracks the startup replay of the consumed topics.
+var replay *replayTracker
 
-func init() {
-	// Initialize Kafka reader to consume all events for analytics
-	kafkaReader = kafka.NewReader(kafka.ReaderConfig{
-		Brokers: []string{kafkaBroker},
-		GroupID: "management-service",
-		Topic:   "orders", // We'll consume from multiple topics
-	})
+// startBackground checks the topics and starts the consumer, monitors and
+// scheduler.
+func startBackground() {
+	kafkaConn.MustEnsureTopics(context.Background())
+	kafkaConn.MustCheckAuditTopic(context.Background())
+
+	db, err := openDatabase()
+	if err != nil {
+		slog.Error("Failed to connect to the database", "error", err)
+		os.Exit(1)
+	}
+	var store *AuditStore
+	var aggregates *AggregateStore
+	if db == nil {
+		slog.Warn("No database configured; the audit log cannot be checked against a stored copy, report schedules are lost on restart and analytics only cover the topics' retention")
+		scheduleStore = NewMemoryScheduleStore()
+	} else {
+		if store, err = NewAuditStore(db); err != nil {
+			slog.Error("Failed to initialize audit store", "error", err)
+			os.Exit(1)
+		}
+		if scheduleStore, err = NewPostgresScheduleStore(db); err != nil {
+			slog.Error("Failed to initialize schedule store", "error", err)
+			os.Exit(1)
+		}
+		if aggregates, err = NewAggregateStore(db); err != nil {
+			slog.Error("Failed to initialize analytics store", "error", err)
+			os.Exit(1)
+		}
+	}
+	analyticsCoverage = NewAnalyticsCoverage(aggregates)
+	if err := analyticsCoverage.Load(context.Background(), aggregator); err != nil {
+		slog.Error("Failed to load analytics", "error", err)
+		os.Exit(1)
+	}
+	auditLog = NewAuditLog(store)
+	ctx, cancel := context.WithTimeout(context.Background(), auditStoreTimeout)
+	err = auditLog.Load(ctx)
+	cancel()
+	if err != nil {
+		slog.Error("Failed to load audit log", "error", err)
+		os.Exit(1)
+	}
 
-	// Initialize mock data
-	initializeMockData()
+	healthChecker.AddCheck("kafka", health.KafkaCheck(kafkaConn))
+	if db != nil {
+		healthChecker.AddCheck("storage", db.PingContext)
+	}
+	warmedUp := healthChecker.WarmUp("replay")
+	replay = newReplayTracker(func() {
+		auditLog.TopicReplayed()
+		warmedUp()
+	})
 
-	// Start background processes
+	go replay.Start()
 	go startEventConsumer()
 	go startMetricsUpdater()
-	
-	log.Println("Management Service initialized")
+	go startReportPurger()
+	go kafkaMonitor.Start()
+	if cfg.Features.ReportScheduler {
+		go startReportScheduler()
+	}
+	if cfg.Features.HealthMonitor {
+		go healthMonitor.Start()
+	}
+	if cfg.Features.LagMonitor {
+		go lagMonitor.Start()
+	}
+
+	slog.Info("Management Service initialized")
 }
 
-func initializeMockData() {
-	mutex.Lock()
-	defer mutex.Unlock()
+// startEventConsumer applies the messages of every partition of the consumed
+// topics, one at a time. Each partition has its own reader and no consumer
+// group is joined: every instance folds the full history into its own
+// aggregate and audit log, rather than replicas splitting the partitions
+// between them. Offsets are never committed, so each start replays the topics
+// from the beginning.
+func startEventConsumer() {
+	loop := healthChecker.Loop("consume-events")
+	loop.Run()
+	defer loop.Exit()
+
+	messages := make(chan kafka.Message)
+	for _, topic := range consumedTopics {
+		for _, partition := range lookupPartitions(topic, loop) {
+			go readPartition(topic, partition, messages, loop)
+		}
+	}
 
-	// Initialize system metrics with mock data
-	systemMetrics = SystemMetrics{
-		Timestamp:       time.Now(),
-		TotalOrders:     156,
-		TodayOrders:     12,
-		TotalRevenue:    7842.38,
-		TodayRevenue:    1247.88,
-		ActiveProducts:  3,
-		LowStockCount:   1,
-		PendingOrders:   8,
-		CompletedOrders: 148,
-	}
-
-	// Initialize system alerts
-	systemAlerts = []SystemAlert{
-		{
-			ID:        uuid.New().String(),
-			Type:      "WARNING",
-			Title:     "Low Stock Alert",
-			Message:   "Product 'Elite Device' has low stock (3 remaining)",
-			CreatedAt: time.Now().Add(-2 * time.Hour),
-			IsRead:    false,
-		},
-		{
-			ID:        uuid.New().String(),
-			Type:      "INFO",
-			Title:     "System Update",
-			Message:   "Management service deployed successfully",
-			CreatedAt: time.Now().Add(-1 * time.Hour),
-			IsRead:    true,
-		},
+	for msg := range messages {
+		loop.Beat()
+		ctx, span := tracing.StartConsume(msg)
+		ctx = logging.WithEventID(ctx, logging.EventID(msg.Value))
+		start := time.Now()
+		updateMetricsFromEvents(ctx, msg)
+		metrics.ObserveConsume(msg.Topic, start, nil)
+		tracing.End(span, nil)
+		replay.Processed(msg)
+		lagTracker.Processed(msg)
 	}
+}
 
-	log.Println("Management Service initialized with mock data")
+// lookupPartitions returns the partition IDs of topic, retrying until the
+// broker answers.
+func lookupPartitions(topic string, loop *health.Loop) []int {
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), kafkaStatsTimeout)
+		partitions, err := kafkaConn.LookupPartitions(ctx, topic)
+		cancel()
+		if err == nil {
+			ids := make([]int, 0, len(partitions))
+			for _, p := range partitions {
+				ids = append(ids, p.ID)
+			}
+			return ids
+		}
+		slog.Warn("Waiting for Kafka to look up partitions", "topic", topic, "error", err)
+		loop.Fail(err)
+		time.Sleep(5 * time.Second)
+	}
 }
 
-func startEventConsumer() {
-	// This would consume events from all topics to build analytics
-	// For now, we'll simulate this with periodic updates
-	ticker := time.NewTicker(30 * time.Second)
-	defer ticker.Stop()
+// readPartition passes every message of one partition, from the earliest
+// offset, to messages.
+func readPartition(topic string, partition int, messages chan<- kafka.Message, loop *health.Loop) {
+	reader := kafkaConn.Reader(kafka.ReaderConfig{Topic: topic, Partition: partition})
+	defer reader.Close()
+	if err := reader.SetOffset(kafka.FirstOffset); err != nil {
+		slog.Error("Error seeking to first offset", "topic", topic, "partition", partition, "error", err)
+		loop.Fail(err)
+		return
+	}
 
-	for range ticker.C {
-		// Simulate processing events and updating metrics
-		updateMetricsFromEvents()
+	for {
+		msg, err := reader.FetchMessage(context.Background())
+		if err != nil {
+			slog.Error("Error reading message", "topic", topic, "partition", partition, "error", err)
+			loop.Fail(err)
+			time.Sleep(time.Second)
+			continue
+		}
+		messages <- msg
 	}
 }
 
@@ -181,31 +274,81 @@ func startMetricsUpdater() {
 	ticker := time.NewTicker(10 * time.Second)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		// Simulate real-time metrics updates
-		mutex.Lock()
-		systemMetrics.Timestamp = time.Now()
-		// Add some randomness for demonstration
-		if rand.Float32() < 0.3 {
-			systemMetrics.TodayOrders++
-			systemMetrics.TotalOrders++
-			revenueIncrease := 29.99 + rand.Float64()*70
-			systemMetrics.TodayRevenue += revenueIncrease
-			systemMetrics.TotalRevenue += revenueIncrease
+	for {
+		refreshInventory()
+		refreshSystemMetrics()
+		<-ticker.C
+	}
+}
+
+func updateMetricsFromEvents(ctx context.Context, msg kafka.Message) {
+	if msg.Topic == cfg.Kafka.Topics.Audit {
+		if !auditLog.Apply(msg) {
+			slog.WarnContext(ctx, "Skipping unrecognised audit message", "partition", msg.Partition, "offset", msg.Offset)
 		}
-		mutex.Unlock()
+		return
 	}
+	order, ok := aggregator.Apply(msg)
+	if !ok {
+		slog.WarnContext(ctx, "Skipping unrecognised message", "topic", msg.Topic, "partition", msg.Partition, "offset", msg.Offset)
+	}
+	analyticsCoverage.Processed(ctx, msg, order)
 }
 
-func updateMetricsFromEvents() {
-	// This would process Kafka events to update metrics
-	// For now, we'll just log that we're processing
-	log.Println("Processing events for metrics update")
+// refreshInventory polls inventory-service for stock levels and raises a
+// warning alert for each product that has newly dropped to its alert level.
+func refreshInventory() {
+	products, err := fetchInventoryProducts()
+	if err != nil {
+		slog.Warn("Failed to refresh inventory", "error", err)
+		return
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	inventoryProducts = products
+	current := make(map[string]bool)
+	for _, product := range products {
+		if !product.IsLowStock() {
+			continue
+		}
+		current[product.ID] = true
+		if !lowStockProducts[product.ID] {
+			systemAlerts = append(systemAlerts, SystemAlert{
+				ID:        uuid.New().String(),
+				Type:      "WARNING",
+				Title:     "Low Stock Alert",
+				Message:   fmt.Sprintf("Product '%s' has low stock (%d remaining)", product.Name, product.Stock),
+				CreatedAt: time.Now(),
+			})
+		}
+	}
+	lowStockProducts = current
+}
+
+// refreshSystemMetrics recomputes systemMetrics from the event aggregate and
+// the last inventory snapshot.
+func refreshSystemMetrics() {
+	metrics := aggregator.Metrics(time.Now())
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	metrics.ActiveProducts = len(inventoryProducts)
+	metrics.LowStockCount = len(lowStockProducts)
+	systemMetrics = metrics
 }
 
 // Dashboard endpoints
 func getDashboardMetrics(c *gin.Context) {
 	period := c.DefaultQuery("period", "today")
+	from, to, _, err := dashboardPeriod(period, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	refreshSystemMetrics()
 	
 	mutex.RLock()
 	defer mutex.RUnlock()
@@ -216,147 +359,293 @@ func getDashboardMetrics(c *gin.Context) {
 		LowStockProducts: systemMetrics.LowStockCount,
 		PendingOrders:    systemMetrics.PendingOrders,
 		Timestamp:        time.Now(),
+		Coverage:         analyticsCoverage.For(from),
 	}
 
-	// Modify based on period
-	switch period {
-	case "week":
-		metrics.TodayOrders = systemMetrics.TodayOrders * 7
-		metrics.TodayRevenue = systemMetrics.TodayRevenue * 7
-	case "month":
-		metrics.TodayOrders = systemMetrics.TodayOrders * 30
-		metrics.TodayRevenue = systemMetrics.TodayRevenue * 30
+	// Longer periods are answered from the analytics buckets
+	if period != "today" {
+		totals := analytics.Total(from, to, "")
+		metrics.TodayOrders = totals.Orders
+		metrics.TodayRevenue = totals.Revenue
 	}
 
 	c.JSON(http.StatusOK, metrics)
 }
 
+// getDashboardCharts builds a chart from the analytics buckets. Query
+// parameters: metric (orders, revenue, aov, failure_rate), period (today,
+// week, month, quarter, year) or start_date/end_date, granularity (hour, day,
+// week, month), product_id to filter, and breakdown=product for one dataset
+// per product. Coverage tells whether the range starts before the analytics
+// are complete.
 func getDashboardCharts(c *gin.Context) {
-	// Generate mock chart data
-	chartData := ChartData{
-		Labels: []string{"Mon", "Tue", "Wed", "Thu", "Fri", "Sat", "Sun"},
-		Datasets: []struct {
-			Label           string    `json:"label"`
-			Data            []float64 `json:"data"`
-			BackgroundColor []string  `json:"backgroundColor,omitempty"`
-			BorderColor     []string  `json:"borderColor,omitempty"`
-		}{
-			{
-				Label: "Revenue",
-				Data:  []float64{1200, 1900, 3000, 5000, 2000, 3000, 1247.88},
-				BackgroundColor: []string{"rgba(54, 162, 235, 0.2)"},
-				BorderColor:     []string{"rgba(54, 162, 235, 1)"},
-			},
-		},
+	metricName := c.DefaultQuery("metric", "revenue")
+	metric, ok := chartMetrics[metricName]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid metric %q (use orders, revenue, aov or failure_rate)", metricName)})
+		return
+	}
+
+	from, to, granularity, err := dashboardPeriod(c.DefaultQuery("period", "week"), time.Now())
+	if err == nil && (c.Query("start_date") != "" || c.Query("end_date") != "") {
+		from, to, err = parseDateRange(c)
+		granularity = Daily
+	}
+	if err == nil && c.Query("granularity") != "" {
+		granularity, err = parseGranularity(c.Query("granularity"))
+	}
+	if err == nil && granularity.bucketCount(from, to) > maxSeriesPoints {
+		err = fmt.Errorf("range too large for granularity=%s (max %d buckets)", granularity, maxSeriesPoints)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	productIDs := []string{c.Query("product_id")}
+	if c.Query("breakdown") == "product" && productIDs[0] == "" {
+		productIDs = sortedProductIDs(analytics.ByProduct(from, to))
+	}
+
+	names := productNames()
+	chartData := ChartData{Datasets: []ChartDataset{}, Coverage: analyticsCoverage.For(from)}
+	var other []SeriesPoint
+	for i, productID := range productIDs {
+		series := analytics.Series(granularity, from, to, productID)
+		if chartData.Labels == nil {
+			chartData.Labels = make([]string, len(series))
+			for j, point := range series {
+				chartData.Labels[j] = point.Label
+			}
+		}
+
+		if i >= maxChartProducts {
+			if other == nil {
+				other = series
+				continue
+			}
+			for j := range other {
+				other[j].Stats.add(&series[j].Stats, 1)
+			}
+			continue
+		}
+
+		label := metric.label
+		if productID != "" {
+			label = names[productID]
+			if label == "" {
+				label = productID
+			}
+		}
+		chartData.Datasets = append(chartData.Datasets, newChartDataset(label, chartValues(series, metric.value), i))
+	}
+	if other != nil {
+		chartData.Datasets = append(chartData.Datasets, newChartDataset("Other", chartValues(other, metric.value), maxChartProducts))
 	}
 
 	c.JSON(http.StatusOK, chartData)
 }
 
+func chartValues(series []SeriesPoint, value func(*BucketStats) float64) []float64 {
+	data := make([]float64, len(series))
+	for i := range series {
+		data[i] = value(&series[i].Stats)
+	}
+	return data
+}
+
 // Analytics endpoints
+
+// parseAnalyticsQuery reads the date range and group_by.
+func parseAnalyticsQuery(c *gin.Context) (from, to time.Time, groupBy Granularity, err error) {
+	groupBy, err = parseGranularity(c.DefaultQuery("group_by", "day"))
+	if err != nil {
+		return
+	}
+	if from, to, err = parseDateRange(c); err != nil {
+		return
+	}
+	if groupBy.bucketCount(from, to) > maxSeriesPoints {
+		err = fmt.Errorf("range too large for group_by=%s (max %d buckets)", groupBy, maxSeriesPoints)
+	}
+	return
+}
+
+// parseDateRange reads start_date and end_date (YYYY-MM-DD or RFC3339, end
+// date inclusive). The range defaults to the last 30 days.
+func parseDateRange(c *gin.Context) (from, to time.Time, err error) {
+	to = Daily.Next(Daily.Truncate(time.Now()))
+	if value := c.Query("end_date"); value != "" {
+		if to, err = parseAnalyticsDate(value); err != nil {
+			err = fmt.Errorf("invalid end_date: %w", err)
+			return
+		}
+		if len(value) == len("2006-01-02") {
+			to = to.AddDate(0, 0, 1)
+		}
+	}
+
+	from = to.AddDate(0, 0, -30)
+	if value := c.Query("start_date"); value != "" {
+		if from, err = parseAnalyticsDate(value); err != nil {
+			err = fmt.Errorf("invalid start_date: %w", err)
+			return
+		}
+	}
+
+	if !from.Before(to) {
+		err = fmt.Errorf("start_date must be before end_date")
+	}
+	return
+}
+
+func parseAnalyticsDate(value string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// previousPeriod returns the range of equal length immediately before from.
+func previousPeriod(from, to time.Time) (time.Time, time.Time) {
+	return from.Add(-to.Sub(from)), from
+}
+
+func productNames() map[string]string {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	names := make(map[string]string, len(inventoryProducts))
+	for _, product := range inventoryProducts {
+		names[product.ID] = product.Name
+	}
+	return names
+}
+
 func getOrdersAnalytics(c *gin.Context) {
-	startDate := c.Query("start_date")
-	endDate := c.Query("end_date")
-	groupBy := c.DefaultQuery("group_by", "day")
-
-	// Generate mock analytics data
-	analytics := []map[string]interface{}{
-		{
-			"date":            "2025-08-20",
-			"total_orders":    12,
-			"completed_orders": 8,
-			"cancelled_orders": 1,
-			"total_revenue":   1247.88,
-		},
-		{
-			"date":            "2025-08-19", 
-			"total_orders":    18,
-			"completed_orders": 15,
-			"cancelled_orders": 0,
-			"total_revenue":   1842.67,
-		},
+	from, to, groupBy, err := parseAnalyticsQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
+	productID := c.Query("product_id")
+
+	series := analytics.Series(groupBy, from, to, productID)
+	analyticsData := make([]map[string]interface{}, 0, len(series))
+	for _, point := range series {
+		analyticsData = append(analyticsData, map[string]interface{}{
+			"date":             point.Label,
+			"total_orders":     point.Stats.Orders,
+			"completed_orders": point.Stats.Completed(),
+			"cancelled_orders": point.Stats.Cancelled(),
+			"total_revenue":    point.Stats.Revenue,
+			"orders_by_status": point.Stats.Statuses,
+		})
+	}
+
+	current := analytics.Total(from, to, productID)
+	prevFrom, prevTo := previousPeriod(from, to)
+	previous := analytics.Total(prevFrom, prevTo, productID)
 
 	c.JSON(http.StatusOK, gin.H{
-		"analytics":  analytics,
-		"start_date": startDate,
-		"end_date":   endDate,
+		"analytics": analyticsData,
+		"summary": map[string]interface{}{
+			"total_orders":          current.Orders,
+			"completed_orders":      current.Completed(),
+			"cancelled_orders":      current.Cancelled(),
+			"orders_by_status":      current.Statuses,
+			"previous_total_orders": previous.Orders,
+			"growth_rate":           growthRate(float64(current.Orders), float64(previous.Orders)),
+		},
+		"start_date": from.Format(time.RFC3339),
+		"end_date":   to.Format(time.RFC3339),
 		"group_by":   groupBy,
+		"coverage":   analyticsCoverage.For(prevFrom),
 	})
 }
 
 func getProductsAnalytics(c *gin.Context) {
-	// Generate mock product analytics
-	analytics := []map[string]interface{}{
-		{
-			"product_id":   "product-1",
-			"product_name": "Premium Widget",
-			"total_sold":   45,
-			"total_revenue": 1349.55,
-			"avg_price":    29.99,
-		},
-		{
-			"product_id":   "product-2",
-			"product_name": "Deluxe Gadget", 
-			"total_sold":   28,
-			"total_revenue": 1399.72,
-			"avg_price":    49.99,
-		},
-		{
-			"product_id":   "product-3",
-			"product_name": "Elite Device",
-			"total_sold":   12,
-			"total_revenue": 1199.88,
-			"avg_price":    99.99,
-		},
+	from, to, _, err := parseAnalyticsQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	prevFrom, prevTo := previousPeriod(from, to)
+	totals := analytics.ByProduct(from, to)
+	previous := analytics.ByProduct(prevFrom, prevTo)
+	names := productNames()
+
+	analyticsData := make([]map[string]interface{}, 0, len(totals))
+	for _, productID := range sortedProductIDs(totals) {
+		stats := totals[productID]
+		avgPrice := 0.0
+		if stats.ItemsSold > 0 {
+			avgPrice = stats.Revenue / float64(stats.ItemsSold)
+		}
+		previousRevenue := 0.0
+		if prev, ok := previous[productID]; ok {
+			previousRevenue = prev.Revenue
+		}
+		analyticsData = append(analyticsData, map[string]interface{}{
+			"product_id":       productID,
+			"product_name":     names[productID],
+			"total_orders":     stats.Orders,
+			"total_sold":       stats.ItemsSold,
+			"total_revenue":    stats.Revenue,
+			"avg_price":        avgPrice,
+			"cancelled_orders": stats.Cancelled(),
+			"growth_rate":      growthRate(stats.Revenue, previousRevenue),
+		})
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"analytics": analytics,
-		"total_products": len(analytics),
+		"analytics":      analyticsData,
+		"total_products": len(analyticsData),
+		"start_date":     from.Format(time.RFC3339),
+		"end_date":       to.Format(time.RFC3339),
+		"coverage":       analyticsCoverage.For(prevFrom),
 	})
 }
 
 func getRevenueAnalytics(c *gin.Context) {
-	startDate := c.Query("start_date")
-	endDate := c.Query("end_date")
-	groupBy := c.DefaultQuery("group_by", "day")
-
-	// Generate mock revenue analytics
-	data := []RevenueAnalytics{
-		{
-			Date:          "2025-08-20",
-			Revenue:       1247.88,
-			Orders:        12,
-			AvgOrderValue: 103.99,
-		},
-		{
-			Date:          "2025-08-19",
-			Revenue:       1842.67,
-			Orders:        18,
-			AvgOrderValue: 102.37,
-		},
-		{
-			Date:          "2025-08-18",
-			Revenue:       2156.34,
-			Orders:        21,
-			AvgOrderValue: 102.68,
-		},
+	from, to, groupBy, err := parseAnalyticsQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
+	productID := c.Query("product_id")
+
+	series := analytics.Series(groupBy, from, to, productID)
+	data := make([]RevenueAnalytics, 0, len(series))
+	for _, point := range series {
+		data = append(data, RevenueAnalytics{
+			Date:          point.Label,
+			Revenue:       point.Stats.Revenue,
+			Orders:        point.Stats.Paid,
+			AvgOrderValue: point.Stats.AvgOrderValue(),
+		})
+	}
+
+	current := analytics.Total(from, to, productID)
+	prevFrom, prevTo := previousPeriod(from, to)
+	previous := analytics.Total(prevFrom, prevTo, productID)
 
 	summary := map[string]interface{}{
-		"total_revenue":    5246.89,
-		"total_orders":     51,
-		"avg_order_value":  102.88,
-		"growth_rate":      12.5,
+		"total_revenue":    current.Revenue,
+		"total_orders":     current.Paid,
+		"avg_order_value":  current.AvgOrderValue(),
+		"previous_revenue": previous.Revenue,
+		"growth_rate":      growthRate(current.Revenue, previous.Revenue),
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"data":       data,
 		"summary":    summary,
-		"start_date": startDate,
-		"end_date":   endDate,
+		"start_date": from.Format(time.RFC3339),
+		"end_date":   to.Format(time.RFC3339),
 		"group_by":   groupBy,
+		"coverage":   analyticsCoverage.For(prevFrom),
 	})
 }
 
@@ -367,44 +656,89 @@ func generateReport(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if err := validateReportRequest(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report := newReport(req)
+	reportID := report.ID
+
+	go runReport(reportID, req)
 
-	reportID := uuid.New().String()
+	slog.InfoContext(c.Request.Context(), "Report generation started", "report_id", reportID, "type", req.Type, "format", req.Format)
+	c.JSON(http.StatusAccepted, gin.H{
+		"report_id": reportID,
+		"status":    "generating",
+	})
+}
 
-	// Create report
+// newReport registers a report for req in the generating state.
+func newReport(req ReportRequest) Report {
 	report := Report{
-		ID:          reportID,
+		ID:          uuid.New().String(),
 		Type:        req.Type,
+		Format:      req.Format,
 		Status:      "generating",
+		StartDate:   req.StartDate,
+		EndDate:     req.EndDate,
 		GeneratedAt: time.Now(),
-		ExpiresAt:   time.Now().Add(24 * time.Hour),
+		ExpiresAt:   time.Now().Add(reportTTL),
 	}
 
 	mutex.Lock()
-	reports[reportID] = report
+	reports[report.ID] = report
 	mutex.Unlock()
 
-	// Simulate report generation (in real implementation, this would be async)
-	go func() {
-		time.Sleep(2 * time.Second) // Simulate processing time
-		
-		mutex.Lock()
-		defer mutex.Unlock()
-		
-		report := reports[reportID]
-		report.Status = "completed"
-		report.Data = map[string]interface{}{
-			"type": req.Type,
-			"generated_at": time.Now(),
-			"summary": "Report generated successfully",
-		}
+	return report
+}
+
+// runReport builds and renders a report and records the outcome.
+func runReport(reportID string, req ReportRequest) (*ReportFile, error) {
+	doc, err := buildReport(req)
+	var file *ReportFile
+	if err == nil {
+		file, err = renderReport(doc, req.Format, reportID)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	report, exists := reports[reportID]
+	if !exists {
+		return nil, fmt.Errorf("report %s was purged while generating", reportID)
+	}
+	if err != nil {
+		slog.Error("Report generation failed", "report_id", reportID, "error", err)
+		report.Status = "failed"
+		report.Error = err.Error()
 		reports[reportID] = report
-	}()
+		return nil, err
+	}
 
-	log.Printf("Report generation started: %s", reportID)
-	c.JSON(http.StatusAccepted, gin.H{
-		"report_id": reportID,
-		"status":    "generating",
-	})
+	report.Status = "completed"
+	report.GeneratedAt = doc.GeneratedAt
+	report.Data = map[string]interface{}{
+		"title":     doc.Title,
+		"summary":   doc.Summary,
+		"row_count": len(doc.Rows),
+		"filename":  file.Filename,
+		"size":      len(file.Content),
+	}
+	report.DownloadURL = "/reports/" + reportID + "/download"
+	reports[reportID] = report
+	reportFiles[reportID] = file
+	slog.Info("Report generated", "report_id", reportID, "filename", file.Filename, "rows", len(doc.Rows))
+	return file, nil
+}
+
+// lookupReport returns a report that has not expired yet.
+func lookupReport(reportID string) (Report, bool) {
+	report, exists := reports[reportID]
+	if !exists || time.Now().After(report.ExpiresAt) {
+		return Report{}, false
+	}
+	return report, true
 }
 
 func getReport(c *gin.Context) {
@@ -413,7 +747,7 @@ func getReport(c *gin.Context) {
 	mutex.RLock()
 	defer mutex.RUnlock()
 
-	report, exists := reports[reportID]
+	report, exists := lookupReport(reportID)
 	if !exists {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Report not found"})
 		return
@@ -422,42 +756,46 @@ func getReport(c *gin.Context) {
 	c.JSON(http.StatusOK, report)
 }
 
+func downloadReport(c *gin.Context) {
+	reportID := c.Param("id")
+
+	mutex.RLock()
+	report, exists := lookupReport(reportID)
+	file := reportFiles[reportID]
+	mutex.RUnlock()
+
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Report not found"})
+		return
+	}
+	if report.Status != "completed" || file == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Report is not ready", "status": report.Status})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, file.Filename))
+	c.Data(http.StatusOK, file.ContentType, file.Content)
+}
+
 // System monitoring
 func getSystemHealth(c *gin.Context) {
-	health := map[string]interface{}{
-		"status": "healthy",
-		"services": []map[string]interface{}{
-			{
-				"name":   "order-service",
-				"status": "healthy",
-				"uptime": "99.9%",
-			},
-			{
-				"name":   "inventory-service",
-				"status": "healthy",
-				"uptime": "99.8%",
-			},
-			{
-				"name":   "product-service",
-				"status": "healthy",
-				"uptime": "100%",
-			},
-			{
-				"name":   "management-service",
-				"status": "healthy",
-				"uptime": "100%",
-			},
-		},
-		"kafka": map[string]interface{}{
-			"status":        "healthy",
-			"topics":        5,
-			"messages_per_sec": 45.2,
-			"consumer_lag":  "< 1ms",
-		},
+	services := healthMonitor.Services()
+	kafka := kafkaMonitor.Health()
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":    overallStatus(services, kafka),
+		"services":  services,
+		"kafka":     kafka,
 		"timestamp": time.Now(),
-	}
+	})
+}
 
-	c.JSON(http.StatusOK, health)
+func getConsumerLag(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"services":      lagMonitor.Reports(),
+		"lag_threshold": lagMonitor.threshold,
+		"stale_after":   lagMonitor.staleAfter.String(),
+	})
 }
 
 func getSystemAlerts(c *gin.Context) {
@@ -484,54 +822,23 @@ func createSystemAlert(c *gin.Context) {
 	mutex.Lock()
 	systemAlerts = append(systemAlerts, alert)
 	mutex.Unlock()
+	auditor.Record(c, "system.alert.create", "alert/"+alert.ID, nil, alert)
 
-	log.Printf("System alert created: %s", alert.Title)
+	slog.InfoContext(c.Request.Context(), "System alert created", "alert_id", alert.ID, "title", alert.Title)
 	c.JSON(http.StatusCreated, alert)
 }
 
-// Admin logs
-func getAdminLogs(c *gin.Context) {
-	mutex.RLock()
-	defer mutex.RUnlock()
-
-	c.JSON(http.StatusOK, gin.H{
-		"logs":  adminLogs,
-		"total": len(adminLogs),
-	})
-}
-
-func createAdminLog(c *gin.Context) {
-	var logEntry AdminLog
-	if err := c.ShouldBindJSON(&logEntry); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-
-	logEntry.ID = uuid.New().String()
-	logEntry.Timestamp = time.Now()
-	logEntry.IPAddress = c.ClientIP()
-
-	mutex.Lock()
-	adminLogs = append(adminLogs, logEntry)
-	mutex.Unlock()
-
-	log.Printf("Admin action logged: %s on %s", logEntry.Action, logEntry.Resource)
-	c.JSON(http.StatusCreated, logEntry)
-}
-
-// Health check endpoint
-func healthCheck(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"status":    "healthy",
-		"service":   "management-service",
-		"timestamp": time.Now(),
-		"version":   "1.0.0",
-	})
-}
-
 func main() {
+	metrics.Init("management-service")
+	tracing.Init("management-service")
+	startBackground()
+
 	// Create Gin router
-	r := gin.Default()
+	r := gin.New()
+	r.Use(gin.Recovery())
+	r.Use(tracing.Middleware())
+	r.Use(logging.Middleware())
+	r.Use(metrics.Middleware())
 
 	// CORS middleware
 	r.Use(func(c *gin.Context) {
@@ -546,9 +853,14 @@ func main() {
 
 		c.Next()
 	})
+	r.Use(authn.Middleware("/dashboard", "/analytics", "/reports", "/system", "/admin"))
+	r.Use(authn.Authorize("management-service"))
 
 	// Routes
-	r.GET("/health", healthCheck)
+	healthChecker.Register(r)
+	metrics.Register(r)
+	lagTracker.Register(r)
+	config.Register(r, cfg)
 
 	// Dashboard routes
 	r.GET("/dashboard/metrics", getDashboardMetrics)
@@ -561,23 +873,34 @@ func main() {
 
 	// Report routes
 	r.POST("/reports/generate", generateReport)
+	r.GET("/reports/schedules", getReportSchedules)
+	r.POST("/reports/schedules", createReportSchedule)
+	r.GET("/reports/schedules/:id", getReportSchedule)
+	r.PUT("/reports/schedules/:id", updateReportSchedule)
+	r.DELETE("/reports/schedules/:id", deleteReportSchedule)
+	r.POST("/reports/schedules/:id/run", runReportScheduleNow)
+	r.GET("/reports/schedules/:id/runs", getReportScheduleRuns)
 	r.GET("/reports/:id", getReport)
+	r.GET("/reports/:id/download", downloadReport)
 
 	// System monitoring routes
 	r.GET("/system/health", getSystemHealth)
+	r.GET("/system/consumer-lag", getConsumerLag)
 	r.GET("/system/alerts", getSystemAlerts)
 	r.POST("/system/alerts", createSystemAlert)
 
 	// Admin log routes
 	r.GET("/admin/logs", getAdminLogs)
+	r.GET("/admin/logs/export", exportAdminLogs)
+	r.GET("/admin/logs/verify", verifyAdminLogs)
+	r.POST("/admin/logs/verify", verifyAdminLogExport)
 	r.POST("/admin/logs", createAdminLog)
 
 	// Start server
-	port := ":8083"
-	log.Printf("Management Service starting on port %s", port)
-	log.Printf("Kafka broker: %s", kafkaBroker)
+	slog.Info("Management Service starting", "addr", cfg.Addr(), "kafka_brokers", cfg.Kafka.Brokers)
 
-	if err := r.Run(port); err != nil {
-		log.Fatal("Failed to start server:", err)
+	if err := r.Run(cfg.Addr()); err != nil {
+		slog.Error("Failed to start server", "error", err)
+		os.Exit(1)
 	}
 }
\ No newline at end of file
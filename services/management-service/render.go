@@ -0,0 +1,376 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// formatCell renders a report value as text for CSV and PDF output.
+func formatCell(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', 2, 64)
+	case bool:
+		if v {
+			return "yes"
+		}
+		return "no"
+	case time.Time:
+		if v.IsZero() {
+			return ""
+		}
+		return v.Format(time.RFC3339)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// columnKey turns a column title into a JSON field name.
+func columnKey(column string) string {
+	return strings.ReplaceAll(strings.ToLower(column), " ", "_")
+}
+
+// summaryRows flattens the summary into sorted key/value pairs; nested maps
+// become "key.subkey" entries.
+func summaryRows(summary map[string]interface{}) [][2]interface{} {
+	var rows [][2]interface{}
+	for key, value := range summary {
+		if nested, ok := value.(map[string]int); ok {
+			for subKey, count := range nested {
+				rows = append(rows, [2]interface{}{key + "." + subKey, count})
+			}
+			continue
+		}
+		rows = append(rows, [2]interface{}{key, value})
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i][0].(string) < rows[j][0].(string) })
+	return rows
+}
+
+func renderJSON(doc *ReportDocument) ([]byte, error) {
+	rows := make([]map[string]interface{}, 0, len(doc.Rows))
+	for _, row := range doc.Rows {
+		record := make(map[string]interface{}, len(row))
+		for i, value := range row {
+			record[columnKey(doc.Columns[i])] = value
+		}
+		rows = append(rows, record)
+	}
+
+	return json.MarshalIndent(map[string]interface{}{
+		"title":        doc.Title,
+		"type":         doc.Type,
+		"start_date":   doc.StartDate,
+		"end_date":     doc.EndDate,
+		"generated_at": doc.GeneratedAt,
+		"summary":      doc.Summary,
+		"rows":         rows,
+	}, "", "  ")
+}
+
+func renderCSV(doc *ReportDocument) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	if err := w.Write(doc.Columns); err != nil {
+		return nil, err
+	}
+	record := make([]string, len(doc.Columns))
+	for _, row := range doc.Rows {
+		for i, value := range row {
+			record[i] = formatCell(value)
+		}
+		if err := w.Write(record); err != nil {
+			return nil, err
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// renderXLSX writes a minimal Office Open XML workbook with a "Report" sheet
+// holding the rows and a "Summary" sheet. Cells use inline strings, so no
+// shared string table or styles part is needed.
+func renderXLSX(doc *ReportDocument) ([]byte, error) {
+	reportSheet := [][]interface{}{stringsToCells(doc.Columns)}
+	reportSheet = append(reportSheet, doc.Rows...)
+
+	summarySheet := [][]interface{}{
+		{"Report", doc.Title},
+		{"Start Date", doc.StartDate},
+		{"End Date", doc.EndDate},
+		{"Generated At", doc.GeneratedAt},
+	}
+	for _, row := range summaryRows(doc.Summary) {
+		summarySheet = append(summarySheet, []interface{}{row[0], row[1]})
+	}
+
+	parts := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+			`<Override PartName="/xl/worksheets/sheet2.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+			`</Types>`},
+		{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets><sheet name="Report" sheetId="1" r:id="rId1"/><sheet name="Summary" sheetId="2" r:id="rId2"/></sheets>` +
+			`</workbook>`},
+		{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+			`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet2.xml"/>` +
+			`</Relationships>`},
+		{"xl/worksheets/sheet1.xml", worksheetXML(reportSheet)},
+		{"xl/worksheets/sheet2.xml", worksheetXML(summarySheet)},
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, part := range parts {
+		w, err := zw.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func stringsToCells(values []string) []interface{} {
+	cells := make([]interface{}, len(values))
+	for i, value := range values {
+		cells[i] = value
+	}
+	return cells
+}
+
+func worksheetXML(rows [][]interface{}) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	for r, row := range rows {
+		fmt.Fprintf(&b, `<row r="%d">`, r+1)
+		for c, value := range row {
+			ref := columnName(c) + strconv.Itoa(r+1)
+			switch v := value.(type) {
+			case int:
+				fmt.Fprintf(&b, `<c r="%s"><v>%d</v></c>`, ref, v)
+			case float64:
+				fmt.Fprintf(&b, `<c r="%s"><v>%s</v></c>`, ref, strconv.FormatFloat(v, 'f', -1, 64))
+			case bool:
+				flag := 0
+				if v {
+					flag = 1
+				}
+				fmt.Fprintf(&b, `<c r="%s" t="b"><v>%d</v></c>`, ref, flag)
+			default:
+				fmt.Fprintf(&b, `<c r="%s" t="inlineStr"><is><t>%s</t></is></c>`, ref, xmlEscape(formatCell(v)))
+			}
+		}
+		b.WriteString(`</row>`)
+	}
+	b.WriteString(`</sheetData></worksheet>`)
+	return b.String()
+}
+
+// columnName converts a zero-based column index to a spreadsheet column (A, B, ..., AA).
+func columnName(index int) string {
+	name := ""
+	for index >= 0 {
+		name = string(rune('A'+index%26)) + name
+		index = index/26 - 1
+	}
+	return name
+}
+
+func xmlEscape(value string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(value))
+	return b.String()
+}
+
+// PDF page layout: A4 landscape with a monospaced font so the table lines up
+// without measuring text. Courier glyphs are 0.6em wide.
+const (
+	pdfPageWidth    = 842
+	pdfPageHeight   = 595
+	pdfMargin       = 36
+	pdfMaxFontSize  = 8.0
+	pdfMinFontSize  = 4.0
+	pdfGlyphWidth   = 0.6
+	pdfMaxColumnLen = 28
+)
+
+// renderPDF writes a plain text PDF using the built-in Courier font. The
+// standard fonts only cover Latin-1, so other characters are replaced by "?".
+func renderPDF(doc *ReportDocument) ([]byte, error) {
+	lines := []string{
+		doc.Title,
+		fmt.Sprintf("Period: %s - %s", doc.StartDate.Format(time.RFC3339), doc.EndDate.Format(time.RFC3339)),
+		fmt.Sprintf("Generated: %s", doc.GeneratedAt.Format(time.RFC3339)),
+		"",
+	}
+	for _, row := range summaryRows(doc.Summary) {
+		lines = append(lines, fmt.Sprintf("%-24s %s", row[0].(string)+":", formatCell(row[1])))
+	}
+	lines = append(lines, "")
+	lines = append(lines, pdfTable(doc)...)
+
+	// Shrink the font until the widest line fits the page.
+	fontSize := pdfMaxFontSize
+	for _, line := range lines {
+		width := float64(len([]rune(line))) * pdfGlyphWidth * fontSize
+		if width > pdfPageWidth-2*pdfMargin {
+			fontSize = (pdfPageWidth - 2*pdfMargin) / (float64(len([]rune(line))) * pdfGlyphWidth)
+		}
+	}
+	if fontSize < pdfMinFontSize {
+		fontSize = pdfMinFontSize
+	}
+	lineHeight := fontSize * 1.25
+
+	linesPerPage := int((pdfPageHeight - 2*pdfMargin) / lineHeight)
+	var pages [][]string
+	for len(lines) > 0 {
+		n := linesPerPage
+		if n > len(lines) {
+			n = len(lines)
+		}
+		pages = append(pages, lines[:n])
+		lines = lines[n:]
+	}
+
+	// Objects: 1 catalog, 2 page tree, 3 font, then a page and a content
+	// stream per page.
+	var objects []string
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+2*i)
+	}
+	objects = append(objects,
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>",
+	)
+	for i, page := range pages {
+		var content strings.Builder
+		fmt.Fprintf(&content, "BT /F1 %.2f Tf %.2f TL %d %d Td\n", fontSize, lineHeight, pdfMargin, pdfPageHeight-pdfMargin)
+		for _, line := range page {
+			fmt.Fprintf(&content, "(%s) Tj T*\n", pdfEscape(line))
+		}
+		fmt.Fprintf(&content, "ET\nBT /F1 %.2f Tf %d %d Td (Page %d of %d) Tj ET\n", pdfMaxFontSize, pdfPageWidth-pdfMargin-80, pdfMargin/2, i+1, len(pages))
+
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>",
+				pdfPageWidth, pdfPageHeight, 5+2*i),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()),
+		)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xrefOffset := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xrefOffset)
+	return buf.Bytes(), nil
+}
+
+// pdfTable lays the rows out as fixed-width text columns.
+func pdfTable(doc *ReportDocument) []string {
+	cells := make([][]string, 0, len(doc.Rows)+1)
+	cells = append(cells, doc.Columns)
+	for _, row := range doc.Rows {
+		record := make([]string, len(row))
+		for i, value := range row {
+			record[i] = formatCell(value)
+		}
+		cells = append(cells, record)
+	}
+
+	widths := make([]int, len(doc.Columns))
+	for _, record := range cells {
+		for i, cell := range record {
+			if n := len([]rune(cell)); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+	for i := range widths {
+		if widths[i] > pdfMaxColumnLen {
+			widths[i] = pdfMaxColumnLen
+		}
+	}
+
+	lines := make([]string, 0, len(cells)+1)
+	for r, record := range cells {
+		parts := make([]string, len(record))
+		for i, cell := range record {
+			runes := []rune(cell)
+			if len(runes) > widths[i] {
+				runes = append(runes[:widths[i]-1], '~')
+			}
+			parts[i] = fmt.Sprintf("%-*s", widths[i], string(runes))
+		}
+		lines = append(lines, strings.Join(parts, "  "))
+		if r == 0 {
+			lines = append(lines, strings.Repeat("-", len([]rune(lines[0]))))
+		}
+	}
+	return lines
+}
+
+// pdfEscape escapes a line for a PDF string literal, mapping it to Latin-1.
+func pdfEscape(line string) string {
+	var b strings.Builder
+	for _, r := range line {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 32:
+			b.WriteByte(' ')
+		case r < 128:
+			b.WriteRune(r)
+		case r < 256:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// replayTracker finishes the startup warm-up once the consumer has reached
+// the end offsets the consumed topics had when the service started. Until
+// then the in-memory aggregate is still being rebuilt.
+type replayTracker struct {
+	mu        sync.Mutex
+	targets   map[string]map[int]int64 // nil until the end offsets are known
+	positions map[string]map[int]int64 // next offset to consume
+	finished  bool
+	done      func()
+}
+
+func newReplayTracker(done func()) *replayTracker {
+	return &replayTracker{
+		positions: make(map[string]map[int]int64),
+		done:      done,
+	}
+}
+
+// Start loads the end offsets, retrying until the broker answers.
+func (t *replayTracker) Start() {
+	client := kafkaConn.Client(kafkaStatsTimeout)
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), kafkaStatsTimeout)
+		offsets, _, _, err := fetchEndOffsets(ctx, client)
+		cancel()
+		if err == nil {
+			t.setTargets(offsets)
+			return
+		}
+		slog.Warn("Waiting for Kafka to load replay targets", "error", err)
+		time.Sleep(5 * time.Second)
+	}
+}
+
+func (t *replayTracker) setTargets(offsets map[string][]kafka.PartitionOffsets) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.targets = make(map[string]map[int]int64)
+	for _, topic := range consumedTopics {
+		t.targets[topic] = make(map[int]int64)
+		for _, partition := range offsets[topic] {
+			if partition.LastOffset > partition.FirstOffset {
+				t.targets[topic][partition.Partition] = partition.LastOffset
+			}
+		}
+	}
+	t.check()
+}
+
+// Processed records that msg has been applied.
+func (t *replayTracker) Processed(msg kafka.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.finished {
+		return
+	}
+	if t.positions[msg.Topic] == nil {
+		t.positions[msg.Topic] = make(map[int]int64)
+	}
+	t.positions[msg.Topic][msg.Partition] = msg.Offset + 1
+	t.check()
+}
+
+// check calls done once every target is reached. Callers hold t.mu.
+func (t *replayTracker) check() {
+	if t.finished || t.targets == nil {
+		return
+	}
+	for topic, partitions := range t.targets {
+		for partition, target := range partitions {
+			if t.positions[topic][partition] < target {
+				return
+			}
+		}
+	}
+	t.finished = true
+	slog.Info("Startup replay complete")
+	t.done()
+}
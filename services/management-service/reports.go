@@ -0,0 +1,305 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+)
+
+// How long generated reports stay downloadable.
+const reportTTL = 24 * time.Hour
+
+var (
+	reportTypes   = map[string]bool{"sales": true, "inventory": true, "orders": true}
+	reportFormats = map[string]bool{"json": true, "csv": true, "xlsx": true, "pdf": true}
+)
+
+// ReportDocument is a generated report before it is rendered to a format.
+type ReportDocument struct {
+	Title       string                 `json:"title"`
+	Type        string                 `json:"type"`
+	StartDate   time.Time              `json:"start_date"`
+	EndDate     time.Time              `json:"end_date"`
+	GeneratedAt time.Time              `json:"generated_at"`
+	Summary     map[string]interface{} `json:"summary"`
+	Columns     []string               `json:"columns"`
+	Rows        [][]interface{}        `json:"rows"`
+}
+
+// ReportFile is a rendered report kept until the report expires.
+type ReportFile struct {
+	Filename    string
+	ContentType string
+	Content     []byte
+}
+
+// validateReportRequest checks type and format and fills in defaults: json
+// output and the 30 days up to now.
+func validateReportRequest(req *ReportRequest) error {
+	if !reportTypes[req.Type] {
+		return fmt.Errorf("invalid report type %q (use sales, inventory or orders)", req.Type)
+	}
+	if req.Format == "" {
+		req.Format = "json"
+	}
+	if !reportFormats[req.Format] {
+		return fmt.Errorf("invalid report format %q (use json, csv, xlsx or pdf)", req.Format)
+	}
+	if req.EndDate.IsZero() {
+		req.EndDate = time.Now()
+	}
+	if req.StartDate.IsZero() {
+		req.StartDate = req.EndDate.AddDate(0, 0, -30)
+	}
+	if !req.StartDate.Before(req.EndDate) {
+		return fmt.Errorf("start_date must be before end_date")
+	}
+	return nil
+}
+
+// buildReport collects the data for req from status-service and
+// inventory-service.
+func buildReport(req ReportRequest) (*ReportDocument, error) {
+	doc := &ReportDocument{
+		Type:        req.Type,
+		StartDate:   req.StartDate,
+		EndDate:     req.EndDate,
+		GeneratedAt: time.Now(),
+		Summary:     make(map[string]interface{}),
+	}
+
+	switch req.Type {
+	case "sales":
+		orders, err := fetchReportOrders(req)
+		if err != nil {
+			return nil, err
+		}
+		products, err := fetchInventoryProducts()
+		if err != nil {
+			// Names are cosmetic; the report is still correct without them.
+			slog.Warn("Sales report without product names", "error", err)
+		}
+		buildSalesReport(doc, orders, products)
+	case "orders":
+		orders, err := fetchReportOrders(req)
+		if err != nil {
+			return nil, err
+		}
+		buildOrdersReport(doc, orders)
+	case "inventory":
+		products, err := fetchInventoryProducts()
+		if err != nil {
+			return nil, fmt.Errorf("load inventory: %w", err)
+		}
+		history, err := fetchInventoryHistory()
+		if err != nil {
+			return nil, fmt.Errorf("load inventory history: %w", err)
+		}
+		buildInventoryReport(doc, products, history)
+	}
+	return doc, nil
+}
+
+// fetchReportOrders returns the orders created within the report period,
+// oldest first.
+func fetchReportOrders(req ReportRequest) ([]StatusOrder, error) {
+	all, err := fetchStatusOrders()
+	if err != nil {
+		return nil, fmt.Errorf("load orders: %w", err)
+	}
+
+	orders := make([]StatusOrder, 0)
+	for _, order := range all {
+		if !order.CreatedAt.Before(req.StartDate) && order.CreatedAt.Before(req.EndDate) {
+			orders = append(orders, order)
+		}
+	}
+	sort.Slice(orders, func(i, j int) bool {
+		return orders[i].CreatedAt.Before(orders[j].CreatedAt)
+	})
+	return orders, nil
+}
+
+func isPaid(status string) bool {
+	return status == StatusPaymentCompleted || status == StatusShipped
+}
+
+func buildSalesReport(doc *ReportDocument, orders []StatusOrder, products []InventoryProduct) {
+	doc.Title = "Sales Report"
+	doc.Columns = []string{"Product ID", "Product Name", "Orders", "Paid Orders", "Units Sold", "Revenue", "Average Price", "Cancelled Orders"}
+
+	names := make(map[string]string)
+	for _, product := range products {
+		names[product.ID] = product.Name
+	}
+
+	type productSales struct {
+		orders, paid, units, cancelled int
+		revenue                        float64
+	}
+	sales := make(map[string]*productSales)
+	var totalRevenue float64
+	var totalPaid, totalUnits int
+	for _, order := range orders {
+		s, exists := sales[order.ProductID]
+		if !exists {
+			s = &productSales{}
+			sales[order.ProductID] = s
+		}
+		s.orders++
+		switch {
+		case isPaid(order.Status):
+			s.paid++
+			s.units += order.Quantity
+			s.revenue += order.PaymentAmount
+			totalPaid++
+			totalUnits += order.Quantity
+			totalRevenue += order.PaymentAmount
+		case isTerminal(order.Status):
+			s.cancelled++
+		}
+	}
+
+	productIDs := make([]string, 0, len(sales))
+	for id := range sales {
+		productIDs = append(productIDs, id)
+	}
+	sort.Slice(productIDs, func(i, j int) bool {
+		return sales[productIDs[i]].revenue > sales[productIDs[j]].revenue
+	})
+
+	for _, id := range productIDs {
+		s := sales[id]
+		avgPrice := 0.0
+		if s.units > 0 {
+			avgPrice = s.revenue / float64(s.units)
+		}
+		doc.Rows = append(doc.Rows, []interface{}{id, names[id], s.orders, s.paid, s.units, s.revenue, avgPrice, s.cancelled})
+	}
+
+	avgOrderValue := 0.0
+	if totalPaid > 0 {
+		avgOrderValue = totalRevenue / float64(totalPaid)
+	}
+	doc.Summary["total_orders"] = len(orders)
+	doc.Summary["paid_orders"] = totalPaid
+	doc.Summary["units_sold"] = totalUnits
+	doc.Summary["total_revenue"] = totalRevenue
+	doc.Summary["avg_order_value"] = avgOrderValue
+	doc.Summary["products"] = len(productIDs)
+}
+
+func buildOrdersReport(doc *ReportDocument, orders []StatusOrder) {
+	doc.Title = "Orders Report"
+	doc.Columns = []string{"Order ID", "Customer ID", "Product ID", "Quantity", "Status", "Fulfilment", "Notification", "Amount", "Tracking Number", "Created At", "Last Updated"}
+
+	byStatus := make(map[string]int)
+	for _, order := range orders {
+		byStatus[order.Status]++
+		doc.Rows = append(doc.Rows, []interface{}{
+			order.OrderID, order.CustomerID, order.ProductID, order.Quantity, order.Status,
+			order.FulfilmentStatus, order.NotificationStatus, order.PaymentAmount, order.TrackingNumber,
+			order.CreatedAt, order.LastUpdated,
+		})
+	}
+
+	doc.Summary["total_orders"] = len(orders)
+	doc.Summary["orders_by_status"] = byStatus
+}
+
+func buildInventoryReport(doc *ReportDocument, products []InventoryProduct, history []InventoryMovement) {
+	doc.Title = "Inventory Report"
+	doc.Columns = []string{"Product ID", "Name", "Category", "Price", "Stock", "Alert Level", "Low Stock", "Stock Value", "Units In", "Units Out"}
+
+	unitsIn := make(map[string]int)
+	unitsOut := make(map[string]int)
+	for _, movement := range history {
+		at, err := time.Parse(time.RFC3339, movement.Timestamp)
+		if err != nil || at.Before(doc.StartDate) || !at.Before(doc.EndDate) {
+			continue
+		}
+		switch movement.Action {
+		case "added", "increased":
+			unitsIn[movement.ProductID] += movement.Quantity
+		case "decreased", "reserved":
+			unitsOut[movement.ProductID] += movement.Quantity
+		}
+	}
+
+	sort.Slice(products, func(i, j int) bool { return products[i].ID < products[j].ID })
+
+	var totalValue float64
+	var totalStock, lowStock int
+	for _, product := range products {
+		value := float64(product.Stock) * product.Price
+		totalValue += value
+		totalStock += product.Stock
+		if product.IsLowStock() {
+			lowStock++
+		}
+		doc.Rows = append(doc.Rows, []interface{}{
+			product.ID, product.Name, product.Category, product.Price, product.Stock, product.AlertLevel,
+			product.IsLowStock(), value, unitsIn[product.ID], unitsOut[product.ID],
+		})
+	}
+
+	doc.Summary["products"] = len(products)
+	doc.Summary["total_stock"] = totalStock
+	doc.Summary["stock_value"] = totalValue
+	doc.Summary["low_stock_products"] = lowStock
+}
+
+// renderReport renders doc in the given format.
+func renderReport(doc *ReportDocument, format, reportID string) (*ReportFile, error) {
+	filename := fmt.Sprintf("%s-report-%s.%s", doc.Type, doc.GeneratedAt.Format("20060102-150405"), format)
+
+	var content []byte
+	var contentType string
+	var err error
+	switch format {
+	case "json":
+		content, err = renderJSON(doc)
+		contentType = "application/json"
+	case "csv":
+		content, err = renderCSV(doc)
+		contentType = "text/csv"
+	case "xlsx":
+		content, err = renderXLSX(doc)
+		contentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	case "pdf":
+		content, err = renderPDF(doc)
+		contentType = "application/pdf"
+	default:
+		err = fmt.Errorf("unsupported format %q", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("render report %s as %s: %w", reportID, format, err)
+	}
+	return &ReportFile{Filename: filename, ContentType: contentType, Content: content}, nil
+}
+
+// purgeExpiredReports deletes reports and their files once ExpiresAt passes.
+func purgeExpiredReports() {
+	now := time.Now()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	for id, report := range reports {
+		if !report.ExpiresAt.IsZero() && now.After(report.ExpiresAt) {
+			delete(reports, id)
+			delete(reportFiles, id)
+			slog.Info("Report expired and purged", "report_id", id)
+		}
+	}
+}
+
+func startReportPurger() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		purgeExpiredReports()
+	}
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ScheduleStore holds the report schedules and their run history. Schedules
+// are returned with their cron expression parsed and LastRunAt set;
+// NextRunAt is left to the caller.
+type ScheduleStore interface {
+	// List returns every schedule, oldest first.
+	List(ctx context.Context) ([]ReportSchedule, error)
+	Get(ctx context.Context, id string) (ReportSchedule, bool, error)
+	// Put creates or replaces a schedule. LastRunAt is not changed.
+	Put(ctx context.Context, schedule ReportSchedule) error
+	// Delete removes a schedule and its runs.
+	Delete(ctx context.Context, id string) (bool, error)
+	// Claim records run as the run of its schedule due at dueAt and reports
+	// true, unless a run for that time is already recorded, as when another
+	// replica claimed it first.
+	Claim(ctx context.Context, run ScheduleRun, dueAt time.Time) (bool, error)
+	// SaveRun records a run or updates one already recorded, and sets the
+	// schedule's LastRunAt to its start.
+	SaveRun(ctx context.Context, run ScheduleRun) error
+	// Runs returns a schedule's runs, newest first.
+	Runs(ctx context.Context, scheduleID string) ([]ScheduleRun, error)
+}
+
+// scheduleStore is set up by startBackground.
+var scheduleStore ScheduleStore
+
+// MemoryScheduleStore keeps schedules for the life of the process only.
+type MemoryScheduleStore struct {
+	mu        sync.RWMutex
+	schedules map[string]ReportSchedule
+	runs      []ScheduleRun
+	lastDue   map[string]time.Time // latest due time claimed, by schedule ID
+}
+
+func NewMemoryScheduleStore() *MemoryScheduleStore {
+	return &MemoryScheduleStore{
+		schedules: make(map[string]ReportSchedule),
+		runs:      []ScheduleRun{},
+		lastDue:   make(map[string]time.Time),
+	}
+}
+
+func (s *MemoryScheduleStore) List(ctx context.Context) ([]ReportSchedule, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	schedules := make([]ReportSchedule, 0, len(s.schedules))
+	for _, schedule := range s.schedules {
+		schedules = append(schedules, schedule)
+	}
+	sort.Slice(schedules, func(i, j int) bool { return schedules[i].CreatedAt.Before(schedules[j].CreatedAt) })
+	return schedules, nil
+}
+
+func (s *MemoryScheduleStore) Get(ctx context.Context, id string) (ReportSchedule, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	schedule, exists := s.schedules[id]
+	return schedule, exists, nil
+}
+
+func (s *MemoryScheduleStore) Put(ctx context.Context, schedule ReportSchedule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedule.LastRunAt = s.schedules[schedule.ID].LastRunAt
+	s.schedules[schedule.ID] = schedule
+	return nil
+}
+
+func (s *MemoryScheduleStore) Delete(ctx context.Context, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.schedules[id]; !exists {
+		return false, nil
+	}
+	delete(s.schedules, id)
+	delete(s.lastDue, id)
+	runs := s.runs[:0]
+	for _, run := range s.runs {
+		if run.ScheduleID != id {
+			runs = append(runs, run)
+		}
+	}
+	s.runs = runs
+	return true, nil
+}
+
+func (s *MemoryScheduleStore) Claim(ctx context.Context, run ScheduleRun, dueAt time.Time) (bool, error) {
+	// The scheduler claims each schedule's due times in order.
+	s.mu.Lock()
+	if !dueAt.After(s.lastDue[run.ScheduleID]) {
+		s.mu.Unlock()
+		return false, nil
+	}
+	s.lastDue[run.ScheduleID] = dueAt
+	s.mu.Unlock()
+	return true, s.SaveRun(ctx, run)
+}
+
+func (s *MemoryScheduleStore) SaveRun(ctx context.Context, run ScheduleRun) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if schedule, exists := s.schedules[run.ScheduleID]; exists {
+		startedAt := run.StartedAt
+		schedule.LastRunAt = &startedAt
+		s.schedules[run.ScheduleID] = schedule
+	}
+	for i := range s.runs {
+		if s.runs[i].ID == run.ID {
+			s.runs[i] = run
+			return nil
+		}
+	}
+	s.runs = append(s.runs, run)
+	if len(s.runs) > maxScheduleRuns {
+		s.runs = s.runs[len(s.runs)-maxScheduleRuns:]
+	}
+	return nil
+}
+
+func (s *MemoryScheduleStore) Runs(ctx context.Context, scheduleID string) ([]ScheduleRun, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	runs := make([]ScheduleRun, 0)
+	for _, run := range s.runs {
+		if run.ScheduleID == scheduleID {
+			runs = append(runs, run)
+		}
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].StartedAt.After(runs[j].StartedAt) })
+	return runs, nil
+}
+
+// scheduleSchema stores schedules and runs as JSON. A run claimed by the
+// scheduler has the time it was due, unique per schedule, so only one
+// replica sharing the database runs it; manual runs have none.
+var scheduleSchema = []string{
+	`CREATE TABLE IF NOT EXISTS report_schedules (
+		id          VARCHAR(64) PRIMARY KEY,
+		schedule    TEXT NOT NULL,
+		created_at  TIMESTAMPTZ NOT NULL,
+		last_run_at TIMESTAMPTZ
+	)`,
+	`CREATE TABLE IF NOT EXISTS report_schedule_runs (
+		id          VARCHAR(64) PRIMARY KEY,
+		schedule_id VARCHAR(64) NOT NULL REFERENCES report_schedules (id) ON DELETE CASCADE,
+		due_at      TIMESTAMPTZ,
+		started_at  TIMESTAMPTZ NOT NULL,
+		run         TEXT NOT NULL,
+		UNIQUE (schedule_id, due_at)
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_report_schedule_runs_started_at ON report_schedule_runs (started_at)`,
+}
+
+// PostgresScheduleStore shares schedules and runs between every replica
+// using the database.
+type PostgresScheduleStore struct {
+	db *sql.DB
+}
+
+func NewPostgresScheduleStore(db *sql.DB) (*PostgresScheduleStore, error) {
+	if err := migrate(db, scheduleSchema); err != nil {
+		return nil, fmt.Errorf("migrate schedule schema: %w", err)
+	}
+	return &PostgresScheduleStore{db: db}, nil
+}
+
+func (s *PostgresScheduleStore) List(ctx context.Context) ([]ReportSchedule, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT schedule, last_run_at FROM report_schedules ORDER BY created_at`)
+	if err != nil {
+		return nil, fmt.Errorf("list schedules: %w", err)
+	}
+	defer rows.Close()
+
+	schedules := []ReportSchedule{}
+	for rows.Next() {
+		schedule, err := scanSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, schedule)
+	}
+	return schedules, rows.Err()
+}
+
+func (s *PostgresScheduleStore) Get(ctx context.Context, id string) (ReportSchedule, bool, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT schedule, last_run_at FROM report_schedules WHERE id = $1`, id)
+	schedule, err := scanSchedule(row)
+	if err == sql.ErrNoRows {
+		return ReportSchedule{}, false, nil
+	}
+	if err != nil {
+		return ReportSchedule{}, false, err
+	}
+	return schedule, true, nil
+}
+
+func scanSchedule(row interface{ Scan(...interface{}) error }) (ReportSchedule, error) {
+	var data string
+	var lastRunAt sql.NullTime
+	if err := row.Scan(&data, &lastRunAt); err != nil {
+		return ReportSchedule{}, err
+	}
+	var schedule ReportSchedule
+	if err := json.Unmarshal([]byte(data), &schedule); err != nil {
+		return ReportSchedule{}, fmt.Errorf("decode schedule: %w", err)
+	}
+	cron, err := ParseCron(schedule.Cron)
+	if err != nil {
+		return ReportSchedule{}, fmt.Errorf("schedule %s: %w", schedule.ID, err)
+	}
+	schedule.cron = cron
+	schedule.LastRunAt = nil
+	if lastRunAt.Valid {
+		schedule.LastRunAt = &lastRunAt.Time
+	}
+	return schedule, nil
+}
+
+func (s *PostgresScheduleStore) Put(ctx context.Context, schedule ReportSchedule) error {
+	data, err := json.Marshal(schedule)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO report_schedules (id, schedule, created_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (id) DO UPDATE SET schedule = EXCLUDED.schedule`,
+		schedule.ID, string(data), schedule.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("save schedule %s: %w", schedule.ID, err)
+	}
+	return nil
+}
+
+func (s *PostgresScheduleStore) Delete(ctx context.Context, id string) (bool, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM report_schedules WHERE id = $1`, id)
+	if err != nil {
+		return false, fmt.Errorf("delete schedule %s: %w", id, err)
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+func (s *PostgresScheduleStore) Claim(ctx context.Context, run ScheduleRun, dueAt time.Time) (bool, error) {
+	data, err := json.Marshal(run)
+	if err != nil {
+		return false, err
+	}
+	result, err := s.db.ExecContext(ctx, `
+		INSERT INTO report_schedule_runs (id, schedule_id, due_at, started_at, run)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (schedule_id, due_at) DO NOTHING`,
+		run.ID, run.ScheduleID, dueAt, run.StartedAt, string(data))
+	if err != nil {
+		return false, fmt.Errorf("claim run of schedule %s due at %s: %w", run.ScheduleID, dueAt.Format(time.RFC3339), err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil || n == 0 {
+		return false, err
+	}
+	return true, s.markRun(ctx, run)
+}
+
+func (s *PostgresScheduleStore) SaveRun(ctx context.Context, run ScheduleRun) error {
+	data, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO report_schedule_runs (id, schedule_id, started_at, run)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (id) DO UPDATE SET run = EXCLUDED.run`,
+		run.ID, run.ScheduleID, run.StartedAt, string(data))
+	if err != nil {
+		return fmt.Errorf("save run %s: %w", run.ID, err)
+	}
+	return s.markRun(ctx, run)
+}
+
+// markRun sets the schedule's LastRunAt and drops the oldest runs beyond
+// maxScheduleRuns.
+func (s *PostgresScheduleStore) markRun(ctx context.Context, run ScheduleRun) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE report_schedules SET last_run_at = $2
+		WHERE id = $1 AND (last_run_at IS NULL OR last_run_at < $2)`,
+		run.ScheduleID, run.StartedAt)
+	if err != nil {
+		return fmt.Errorf("update schedule %s: %w", run.ScheduleID, err)
+	}
+	_, err = s.db.ExecContext(ctx, `
+		DELETE FROM report_schedule_runs WHERE id IN (
+			SELECT id FROM report_schedule_runs ORDER BY started_at DESC OFFSET $1
+		)`, maxScheduleRuns)
+	if err != nil {
+		return fmt.Errorf("prune schedule runs: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresScheduleStore) Runs(ctx context.Context, scheduleID string) ([]ScheduleRun, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT run FROM report_schedule_runs WHERE schedule_id = $1 ORDER BY started_at DESC`, scheduleID)
+	if err != nil {
+		return nil, fmt.Errorf("list runs of schedule %s: %w", scheduleID, err)
+	}
+	defer rows.Close()
+
+	runs := []ScheduleRun{}
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var run ScheduleRun
+		if err := json.Unmarshal([]byte(data), &run); err != nil {
+			return nil, fmt.Errorf("decode run: %w", err)
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
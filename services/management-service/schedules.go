@@ -0,0 +1,449 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Report periods a schedule can cover, ending at the time it runs.
+var schedulePeriods = map[string]time.Duration{
+	"hour":  time.Hour,
+	"day":   24 * time.Hour,
+	"week":  7 * 24 * time.Hour,
+	"month": 30 * 24 * time.Hour,
+}
+
+// Runs kept in the history across all schedules.
+const maxScheduleRuns = 500
+
+// ReportSchedule generates a report on a cron schedule and sends it to the
+// recipients through notification-service.
+type ReportSchedule struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Cron       string     `json:"cron"`   // five-field cron expression, UTC
+	Type       string     `json:"type"`   // sales, inventory, orders
+	Format     string     `json:"format"` // json, csv, xlsx, pdf
+	Period     string     `json:"period"` // hour, day, week, month before each run
+	Recipients []string   `json:"recipients"`
+	Enabled    bool       `json:"enabled"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	LastRunAt  *time.Time `json:"last_run_at,omitempty"`
+	NextRunAt  *time.Time `json:"next_run_at,omitempty"` // nil while disabled
+
+	cron *CronExpression
+}
+
+// ScheduleRequest creates or replaces a schedule.
+type ScheduleRequest struct {
+	Name       string   `json:"name" binding:"required"`
+	Cron       string   `json:"cron" binding:"required"`
+	Type       string   `json:"type" binding:"required"`
+	Format     string   `json:"format"`
+	Period     string   `json:"period"`
+	Recipients []string `json:"recipients" binding:"required,min=1"`
+	Enabled    *bool    `json:"enabled"`
+}
+
+// ScheduleRun is one execution of a schedule.
+type ScheduleRun struct {
+	ID         string    `json:"id"`
+	ScheduleID string    `json:"schedule_id"`
+	ReportID   string    `json:"report_id,omitempty"`
+	Trigger    string    `json:"trigger"` // schedule, manual
+	Status     string    `json:"status"`  // running, completed, failed
+	Error      string    `json:"error,omitempty"`
+	Delivered  bool      `json:"delivered"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at,omitempty"`
+}
+
+// applyScheduleRequest validates req and copies it onto schedule.
+func applyScheduleRequest(schedule *ReportSchedule, req ScheduleRequest) error {
+	cron, err := ParseCron(req.Cron)
+	if err != nil {
+		return err
+	}
+	if req.Period == "" {
+		req.Period = "day"
+	}
+	if _, ok := schedulePeriods[req.Period]; !ok {
+		return fmt.Errorf("invalid period %q (use hour, day, week or month)", req.Period)
+	}
+	reportReq := ReportRequest{Type: req.Type, Format: req.Format}
+	if err := validateReportRequest(&reportReq); err != nil {
+		return err
+	}
+	for _, recipient := range req.Recipients {
+		if strings.TrimSpace(recipient) == "" {
+			return fmt.Errorf("recipients must not be empty")
+		}
+	}
+
+	schedule.Name = req.Name
+	schedule.Cron = req.Cron
+	schedule.Type = reportReq.Type
+	schedule.Format = reportReq.Format
+	schedule.Period = req.Period
+	schedule.Recipients = req.Recipients
+	schedule.Enabled = req.Enabled == nil || *req.Enabled
+	schedule.UpdatedAt = time.Now()
+	schedule.cron = cron
+	*schedule = schedule.withNextRun(schedule.UpdatedAt)
+	return nil
+}
+
+// withNextRun sets NextRunAt to the schedule's first cron time after now, or
+// nil while it is disabled.
+func (s ReportSchedule) withNextRun(now time.Time) ReportSchedule {
+	s.NextRunAt = nil
+	if s.Enabled {
+		next := s.cron.Next(now)
+		s.NextRunAt = &next
+	}
+	return s
+}
+
+// startReportScheduler wakes at the start of every minute and runs the
+// schedules that came due since the last minute it checked. Every replica
+// checks; the store lets only one of them claim each due run.
+func startReportScheduler() {
+	since := time.Now()
+	for {
+		now := time.Now().Truncate(time.Minute).Add(time.Minute)
+		time.Sleep(time.Until(now))
+		if runDueSchedules(since, now) {
+			since = now
+		}
+	}
+}
+
+// runDueSchedules starts the run of every enabled schedule with a cron time
+// in (since, now] that it can claim, the latest such time if several. It
+// reports false if the schedules could not be read, so the next check covers
+// this minute too.
+func runDueSchedules(since, now time.Time) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Services.Timeout)
+	defer cancel()
+	schedules, err := scheduleStore.List(ctx)
+	if err != nil {
+		slog.Error("Error loading report schedules", "error", err)
+		return false
+	}
+
+	for _, schedule := range schedules {
+		if !schedule.Enabled {
+			continue
+		}
+		// A schedule changed during the window is due from the change on.
+		from := since
+		if schedule.UpdatedAt.After(from) {
+			from = schedule.UpdatedAt
+		}
+		var due time.Time
+		for next := schedule.cron.Next(from); !next.IsZero() && !next.After(now); next = schedule.cron.Next(next) {
+			due = next
+		}
+		if due.IsZero() {
+			continue
+		}
+
+		run := newScheduleRun(schedule, "schedule")
+		claimed, err := scheduleStore.Claim(ctx, run, due)
+		if err != nil {
+			slog.Error("Error claiming scheduled report", "schedule_id", schedule.ID, "due_at", due, "error", err)
+			continue
+		}
+		if claimed {
+			go runSchedule(schedule, run)
+		}
+	}
+	return true
+}
+
+func newScheduleRun(schedule ReportSchedule, trigger string) ScheduleRun {
+	return ScheduleRun{
+		ID:         uuid.New().String(),
+		ScheduleID: schedule.ID,
+		Trigger:    trigger,
+		Status:     "running",
+		StartedAt:  time.Now(),
+	}
+}
+
+// runSchedule generates the schedule's report for run, already recorded,
+// delivers it and records the outcome. Failures raise an ERROR system alert.
+func runSchedule(schedule ReportSchedule, run ScheduleRun) ScheduleRun {
+	req := ReportRequest{
+		Type:      schedule.Type,
+		Format:    schedule.Format,
+		StartDate: run.StartedAt.Add(-schedulePeriods[schedule.Period]),
+		EndDate:   run.StartedAt,
+	}
+	report := newReport(req)
+	run.ReportID = report.ID
+	saveScheduleRun(run)
+
+	_, err := runReport(report.ID, req)
+	if err == nil {
+		err = deliverScheduledReport(schedule, report.ID)
+		run.Delivered = err == nil
+	}
+
+	run.FinishedAt = time.Now()
+	run.Status = "completed"
+	if err != nil {
+		run.Status = "failed"
+		run.Error = err.Error()
+		slog.Error("Scheduled report failed", "schedule_id", schedule.ID, "schedule", schedule.Name, "error", err)
+	}
+	saveScheduleRun(run)
+
+	if err != nil {
+		mutex.Lock()
+		systemAlerts = append(systemAlerts, SystemAlert{
+			ID:        uuid.New().String(),
+			Type:      "ERROR",
+			Title:     "Scheduled Report Failed",
+			Message:   fmt.Sprintf("Schedule '%s' failed to produce its %s report: %v", schedule.Name, schedule.Type, err),
+			CreatedAt: time.Now(),
+		})
+		mutex.Unlock()
+	}
+
+	return run
+}
+
+// saveScheduleRun records run in the history. A run that cannot be recorded
+// still goes ahead; only its history is lost.
+func saveScheduleRun(run ScheduleRun) {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Services.Timeout)
+	defer cancel()
+	if err := scheduleStore.SaveRun(ctx, run); err != nil {
+		slog.Error("Error recording schedule run", "schedule_id", run.ScheduleID, "run_id", run.ID, "error", err)
+	}
+}
+
+// deliverScheduledReport sends the download link to the schedule's
+// recipients through notification-service.
+func deliverScheduledReport(schedule ReportSchedule, reportID string) error {
+	mutex.RLock()
+	report := reports[reportID]
+	mutex.RUnlock()
+
+	message := fmt.Sprintf("Your scheduled %s report '%s' for %s to %s is ready: %s%s (available until %s).",
+		schedule.Type, schedule.Name,
+		report.StartDate.Format(time.RFC3339), report.EndDate.Format(time.RFC3339),
+		cfg.PublicURL, report.DownloadURL, report.ExpiresAt.Format(time.RFC3339))
+
+	body, err := json.Marshal(map[string]interface{}{
+		"recipients": schedule.Recipients,
+		"subject":    fmt.Sprintf("Scheduled report: %s", schedule.Name),
+		"message":    message,
+		"channel":    "email",
+		"reference":  reportID,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, cfg.Services.Notification+"/notifications", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if cfg.ServiceToken != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.ServiceToken)
+	}
+	resp, err := serviceClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("deliver report: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("deliver report: notification-service returned %s", resp.Status)
+	}
+	return nil
+}
+
+func scheduleStoreError(c *gin.Context, err error) {
+	slog.ErrorContext(c.Request.Context(), "Schedule store error", "error", err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Schedule store unavailable"})
+}
+
+// Schedule endpoints
+func getReportSchedules(c *gin.Context) {
+	schedules, err := scheduleStore.List(c.Request.Context())
+	if err != nil {
+		scheduleStoreError(c, err)
+		return
+	}
+	now := time.Now()
+	for i := range schedules {
+		schedules[i] = schedules[i].withNextRun(now)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"schedules": schedules,
+		"total":     len(schedules),
+	})
+}
+
+func createReportSchedule(c *gin.Context) {
+	var req ScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	schedule := ReportSchedule{
+		ID:        uuid.New().String(),
+		CreatedAt: time.Now(),
+	}
+	if err := applyScheduleRequest(&schedule, req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := scheduleStore.Put(c.Request.Context(), schedule); err != nil {
+		scheduleStoreError(c, err)
+		return
+	}
+	auditor.Record(c, "report_schedule.create", "report_schedule/"+schedule.ID, nil, schedule)
+
+	slog.Info("Report schedule created", "schedule_id", schedule.ID, "schedule", schedule.Name, "cron", schedule.Cron)
+	c.JSON(http.StatusCreated, schedule)
+}
+
+func getReportSchedule(c *gin.Context) {
+	ctx := c.Request.Context()
+	schedule, exists, err := scheduleStore.Get(ctx, c.Param("id"))
+	if err != nil {
+		scheduleStoreError(c, err)
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Schedule not found"})
+		return
+	}
+	runs, err := scheduleStore.Runs(ctx, schedule.ID)
+	if err != nil {
+		scheduleStoreError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"schedule": schedule.withNextRun(time.Now()),
+		"runs":     runs,
+	})
+}
+
+func updateReportSchedule(c *gin.Context) {
+	var req ScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := c.Request.Context()
+	before, exists, err := scheduleStore.Get(ctx, c.Param("id"))
+	if err != nil {
+		scheduleStoreError(c, err)
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Schedule not found"})
+		return
+	}
+	before = before.withNextRun(time.Now())
+	updated := before
+	if err := applyScheduleRequest(&updated, req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := scheduleStore.Put(ctx, updated); err != nil {
+		scheduleStoreError(c, err)
+		return
+	}
+
+	auditor.Record(c, "report_schedule.update", "report_schedule/"+updated.ID, before, updated)
+	c.JSON(http.StatusOK, updated)
+}
+
+func deleteReportSchedule(c *gin.Context) {
+	scheduleID := c.Param("id")
+
+	ctx := c.Request.Context()
+	schedule, exists, err := scheduleStore.Get(ctx, scheduleID)
+	if err == nil && exists {
+		exists, err = scheduleStore.Delete(ctx, scheduleID)
+	}
+	if err != nil {
+		scheduleStoreError(c, err)
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Schedule not found"})
+		return
+	}
+
+	auditor.Record(c, "report_schedule.delete", "report_schedule/"+scheduleID, schedule, nil)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Schedule deleted successfully"})
+}
+
+// runReportScheduleNow runs a schedule immediately, outside its cron times.
+func runReportScheduleNow(c *gin.Context) {
+	schedule, exists, err := scheduleStore.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		scheduleStoreError(c, err)
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Schedule not found"})
+		return
+	}
+
+	run := runSchedule(schedule, newScheduleRun(schedule, "manual"))
+	status := http.StatusOK
+	if run.Status == "failed" {
+		status = http.StatusBadGateway
+	}
+	c.JSON(status, run)
+}
+
+func getReportScheduleRuns(c *gin.Context) {
+	scheduleID := c.Param("id")
+
+	ctx := c.Request.Context()
+	_, exists, err := scheduleStore.Get(ctx, scheduleID)
+	if err != nil {
+		scheduleStoreError(c, err)
+		return
+	}
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Schedule not found"})
+		return
+	}
+	runs, err := scheduleStore.Runs(ctx, scheduleID)
+	if err != nil {
+		scheduleStoreError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"runs":  runs,
+		"total": len(runs),
+	})
+}
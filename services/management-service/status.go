@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// StatusOrder is an order as projected by status-service.
+type StatusOrder struct {
+	OrderID            string    `json:"order_id"`
+	ProductID          string    `json:"product_id"`
+	CustomerID         string    `json:"customer_id"`
+	Quantity           int       `json:"quantity"`
+	Status             string    `json:"status"`
+	NotificationStatus string    `json:"notification_status"`
+	FulfilmentStatus   string    `json:"fulfilment_status"`
+	CreatedAt          time.Time `json:"created_at"`
+	LastUpdated        time.Time `json:"last_updated"`
+	TrackingNumber     string    `json:"tracking_number"`
+	PaymentAmount      float64   `json:"payment_amount"`
+}
+
+// fetchStatusOrders loads every order from status-service, which holds the
+// authoritative per-order projection.
+func fetchStatusOrders() ([]StatusOrder, error) {
+	resp, err := serviceClient.Get(cfg.Services.Status + "/orders")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status-service returned %s", resp.Status)
+	}
+
+	// The orders come keyed by order ID.
+	var body struct {
+		Orders map[string]StatusOrder `json:"orders"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("decode status orders: %w", err)
+	}
+
+	orders := make([]StatusOrder, 0, len(body.Orders))
+	for _, order := range body.Orders {
+		orders = append(orders, order)
+	}
+	sort.Slice(orders, func(i, j int) bool {
+		if !orders[i].CreatedAt.Equal(orders[j].CreatedAt) {
+			return orders[i].CreatedAt.Before(orders[j].CreatedAt)
+		}
+		return orders[i].OrderID < orders[j].OrderID
+	})
+	return orders, nil
+}
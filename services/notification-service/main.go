@@ -4,14 +4,20 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
-	"os"
 	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/segmentio/kafka-go"
+
+	"shared/config"
+	"shared/health"
+	"shared/lag"
+	"shared/logging"
+	"shared/metrics"
+	"shared/tracing"
 )
 
 type PaymentEvent struct {
@@ -30,6 +36,19 @@ type NotificationEvent struct {
 	Message       string    `json:"message"`
 	Channel       string    `json:"channel"`
 	SentAt        time.Time `json:"sent_at"`
+	Recipients    []string  `json:"recipients,omitempty"`
+	Subject       string    `json:"subject,omitempty"`
+	Reference     string    `json:"reference,omitempty"`
+}
+
+// NotificationRequest asks for a notification that is not tied to an order,
+// such as a scheduled report sent by management-service.
+type NotificationRequest struct {
+	Recipients []string `json:"recipients" binding:"required,min=1,dive,required"`
+	Subject    string   `json:"subject" binding:"required"`
+	Message    string   `json:"message" binding:"required"`
+	Channel    string   `json:"channel"`   // defaults to email
+	Reference  string   `json:"reference"` // caller's ID for the notification, e.g. a report ID
 }
 
 type NotificationLog struct {
@@ -59,19 +78,14 @@ func (nl *NotificationLog) GetLogs() []NotificationEvent {
 
 var notificationLog = NewNotificationLog()
 
-func getKafkaBroker() string {
-	if broker := os.Getenv("KAFKA_BROKER"); broker != "" {
-		return broker
-	}
-	return "localhost:9092"
-}
+// healthChecker backs /health, /health/live and /health/ready.
+var healthChecker = health.New("notification-service")
 
-func publishNotificationEvent(event NotificationEvent) error {
-	writer := &kafka.Writer{
-		Addr:     kafka.TCP(getKafkaBroker()),
-		Topic:    "notification",
-		Balancer: &kafka.LeastBytes{},
-	}
+// lagTracker backs /consumer/lag.
+var lagTracker = lag.NewTracker("notification-service", cfg.Kafka.GroupID, kafkaConn, cfg.Kafka.Topics.Payment)
+
+func publishNotificationEvent(ctx context.Context, event NotificationEvent) error {
+	writer := kafkaConn.Writer(cfg.Kafka.Topics.Notification)
 	defer writer.Close()
 
 	eventBytes, err := json.Marshal(event)
@@ -79,16 +93,25 @@ func publishNotificationEvent(event NotificationEvent) error {
 		return err
 	}
 
-	return writer.WriteMessages(context.Background(),
-		kafka.Message{
-			Key:   []byte(event.OrderID),
-			Value: eventBytes,
-		},
-	)
+	msg := kafka.Message{
+		Key:   []byte(event.OrderID),
+		Value: eventBytes,
+	}
+
+	ctx, span := tracing.StartPublish(ctx, cfg.Kafka.Topics.Notification, &msg)
+	ctx = logging.WithEventID(ctx, logging.EventID(eventBytes))
+	start := time.Now()
+	err = writer.WriteMessages(ctx, msg)
+	metrics.ObservePublish(cfg.Kafka.Topics.Notification, start, err)
+	tracing.End(span, err)
+	if err == nil {
+		slog.DebugContext(ctx, "Event published", "topic", cfg.Kafka.Topics.Notification)
+	}
+	return err
 }
 
-func sendNotification(orderID string, message string) NotificationEvent {
-	time.Sleep(50 * time.Millisecond)
+func sendNotification(ctx context.Context, orderID string, message string) NotificationEvent {
+	time.Sleep(cfg.SendDelay)
 
 	event := NotificationEvent{
 		OrderID:   orderID,
@@ -98,50 +121,65 @@ func sendNotification(orderID string, message string) NotificationEvent {
 		SentAt:    time.Now(),
 	}
 
-	log.Printf("Sending notification for order: %s - %s", orderID, message)
+	slog.InfoContext(ctx, "Sending notification", "channel", event.Channel, "message", message)
 	
 	return event
 }
 
-func processPaymentEvent(event PaymentEvent) {
+func processPaymentEvent(ctx context.Context, event PaymentEvent) {
 	if event.EventType != "PaymentCompleted" {
-		log.Printf("Ignoring payment event: %s for order: %s", event.EventType, event.OrderID)
+		slog.DebugContext(ctx, "Ignoring payment event", "event_type", event.EventType)
 		return
 	}
 
 	message := fmt.Sprintf("Payment of $%.2f completed for order %s. Your order will be processed soon.", 
 		event.Amount, event.OrderID)
 
-	notificationEvent := sendNotification(event.OrderID, message)
+	notificationEvent := sendNotification(ctx, event.OrderID, message)
 	notificationLog.AddLog(notificationEvent)
 
-	if err := publishNotificationEvent(notificationEvent); err != nil {
-		log.Printf("Failed to publish notification event: %v", err)
+	if err := publishNotificationEvent(ctx, notificationEvent); err != nil {
+		slog.ErrorContext(ctx, "Failed to publish notification event", "error", err)
 	}
 }
 
 func consumePaymentEvents() {
-	reader := kafka.NewReader(kafka.ReaderConfig{
-		Brokers: []string{getKafkaBroker()},
-		Topic:   "payment",
-		GroupID: "notification-service",
+	loop := healthChecker.Loop("consume-payment")
+	loop.Run()
+	defer loop.Exit()
+
+	reader := kafkaConn.Reader(kafka.ReaderConfig{
+		Topic:   cfg.Kafka.Topics.Payment,
+		GroupID: cfg.Kafka.GroupID,
 	})
 	defer reader.Close()
 
 	for {
 		msg, err := reader.ReadMessage(context.Background())
 		if err != nil {
-			log.Printf("Error reading message: %v", err)
+			slog.Error("Error reading message", "topic", cfg.Kafka.Topics.Payment, "error", err)
+			loop.Fail(err)
 			continue
 		}
+		loop.Beat()
+		ctx, span := tracing.StartConsume(msg)
+		ctx = logging.WithEventID(ctx, logging.EventID(msg.Value))
+		start := time.Now()
 
 		var event PaymentEvent
 		if err := json.Unmarshal(msg.Value, &event); err != nil {
-			log.Printf("Error unmarshaling message: %v", err)
+			slog.ErrorContext(ctx, "Error unmarshaling message", "topic", msg.Topic, "error", err)
+			metrics.ObserveConsume(msg.Topic, start, err)
+			tracing.End(span, err)
 			continue
 		}
 
-		processPaymentEvent(event)
+		ctx = logging.WithOrderID(ctx, event.OrderID)
+		tracing.OrderID(ctx, event.OrderID)
+		processPaymentEvent(ctx, event)
+		metrics.ObserveConsume(msg.Topic, start, nil)
+		tracing.End(span, nil)
+		lagTracker.Processed(msg)
 	}
 }
 
@@ -151,17 +189,56 @@ func getNotifications(c *gin.Context) {
 	})
 }
 
-func healthCheck(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"status": "healthy", "service": "notification-service"})
+func createNotification(c *gin.Context) {
+	var req NotificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Channel == "" {
+		req.Channel = "email"
+	}
+
+	event := NotificationEvent{
+		EventType:  "NotificationSent",
+		Message:    req.Message,
+		Channel:    req.Channel,
+		SentAt:     time.Now(),
+		Recipients: req.Recipients,
+		Subject:    req.Subject,
+		Reference:  req.Reference,
+	}
+
+	slog.InfoContext(c.Request.Context(), "Sending notification",
+		"channel", req.Channel, "recipients", req.Recipients, "subject", req.Subject, "reference", req.Reference)
+	notificationLog.AddLog(event)
+
+	c.JSON(http.StatusCreated, event)
 }
 
 func main() {
+	metrics.Init("notification-service")
+	tracing.Init("notification-service")
+	kafkaConn.MustEnsureTopics(context.Background())
+
+	healthChecker.AddCheck("kafka", health.KafkaCheck(kafkaConn))
+
 	go consumePaymentEvents()
 
-	r := gin.Default()
+	r := gin.New()
+	r.Use(gin.Recovery())
+	r.Use(tracing.Middleware())
+	r.Use(logging.Middleware())
+	r.Use(metrics.Middleware())
+	r.Use(authn.Middleware())
+	r.Use(authn.Authorize("notification-service"))
 	r.GET("/notifications", getNotifications)
-	r.GET("/health", healthCheck)
-
-	log.Printf("Notification Service starting on port :8085")
-	r.Run(":8085")
+	r.POST("/notifications", createNotification)
+	healthChecker.Register(r)
+	metrics.Register(r)
+	config.Register(r, cfg)
+	lagTracker.Register(r)
+
+	slog.Info("Notification Service starting", "addr", cfg.Addr())
+	r.Run(cfg.Addr())
 }
\ No newline at end of file
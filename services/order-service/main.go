@@ -3,40 +3,40 @@ package main
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
-	"os"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/segmentio/kafka-go"
+
+	"shared/config"
+	"shared/health"
+	"shared/logging"
+	"shared/metrics"
+	"shared/tracing"
 )
 
 type OrderRequest struct {
-	ProductID string `json:"product_id" binding:"required"`
-	Quantity  int    `json:"quantity" binding:"required,min=1"`
+	ProductID  string `json:"product_id" binding:"required"`
+	Quantity   int    `json:"quantity" binding:"required,min=1"`
+	CustomerID string `json:"customer_id"`
 }
 
 type OrderCreatedEvent struct {
-	OrderID   string `json:"order_id"`
-	ProductID string `json:"product_id"`
-	Quantity  int    `json:"quantity"`
-	EventType string `json:"event_type"`
+	OrderID    string `json:"order_id"`
+	ProductID  string `json:"product_id"`
+	Quantity   int    `json:"quantity"`
+	CustomerID string `json:"customer_id,omitempty"`
+	EventType  string `json:"event_type"`
 }
 
-func getKafkaBroker() string {
-	if broker := os.Getenv("KAFKA_BROKER"); broker != "" {
-		return broker
-	}
-	return "localhost:9092"
-}
+// healthChecker backs /health, /health/live and /health/ready.
+var healthChecker = health.New("order-service")
 
-func publishOrderEvent(orderEvent OrderCreatedEvent) error {
-	writer := &kafka.Writer{
-		Addr:     kafka.TCP(getKafkaBroker()),
-		Topic:    "orders",
-		Balancer: &kafka.LeastBytes{},
-	}
+func publishOrderEvent(ctx context.Context, orderEvent OrderCreatedEvent) error {
+	writer := kafkaConn.Writer(cfg.Kafka.Topics.Orders)
 	defer writer.Close()
 
 	eventBytes, err := json.Marshal(orderEvent)
@@ -44,12 +44,21 @@ func publishOrderEvent(orderEvent OrderCreatedEvent) error {
 		return err
 	}
 
-	return writer.WriteMessages(context.Background(),
-		kafka.Message{
-			Key:   []byte(orderEvent.OrderID),
-			Value: eventBytes,
-		},
-	)
+	msg := kafka.Message{
+		Key:   []byte(orderEvent.OrderID),
+		Value: eventBytes,
+	}
+
+	ctx, span := tracing.StartPublish(ctx, cfg.Kafka.Topics.Orders, &msg)
+	ctx = logging.WithEventID(ctx, logging.EventID(eventBytes))
+	start := time.Now()
+	err = writer.WriteMessages(ctx, msg)
+	metrics.ObservePublish(cfg.Kafka.Topics.Orders, start, err)
+	tracing.End(span, err)
+	if err == nil {
+		slog.DebugContext(ctx, "Event published", "topic", cfg.Kafka.Topics.Orders)
+	}
+	return err
 }
 
 func createOrder(c *gin.Context) {
@@ -60,38 +69,54 @@ func createOrder(c *gin.Context) {
 	}
 
 	orderID := uuid.New().String()
+	ctx := logging.WithOrderID(c.Request.Context(), orderID)
+	tracing.OrderID(ctx, orderID)
 
 	orderEvent := OrderCreatedEvent{
-		OrderID:   orderID,
-		ProductID: req.ProductID,
-		Quantity:  req.Quantity,
-		EventType: "OrderCreated",
+		OrderID:    orderID,
+		ProductID:  req.ProductID,
+		Quantity:   req.Quantity,
+		CustomerID: req.CustomerID,
+		EventType:  "OrderCreated",
 	}
 
-	if err := publishOrderEvent(orderEvent); err != nil {
-		log.Printf("Failed to publish order event: %v", err)
+	if err := publishOrderEvent(ctx, orderEvent); err != nil {
+		slog.ErrorContext(ctx, "Failed to publish order event", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create order"})
 		return
 	}
+	metrics.OrdersCreated.Inc()
+	slog.InfoContext(ctx, "Order created", "product_id", req.ProductID, "quantity", req.Quantity)
 
 	c.JSON(http.StatusCreated, gin.H{
-		"order_id":   orderID,
-		"product_id": req.ProductID,
-		"quantity":   req.Quantity,
-		"status":     "created",
+		"order_id":    orderID,
+		"product_id":  req.ProductID,
+		"quantity":    req.Quantity,
+		"customer_id": req.CustomerID,
+		"status":      "created",
 	})
 }
 
-func healthCheck(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"status": "healthy", "service": "order-service"})
-}
-
 func main() {
-	r := gin.Default()
+	metrics.Init("order-service", metrics.OrdersCreated)
+	tracing.Init("order-service")
+	kafkaConn.MustEnsureTopics(context.Background())
+
+	healthChecker.AddCheck("kafka", health.KafkaCheck(kafkaConn))
+
+	r := gin.New()
+	r.Use(gin.Recovery())
+	r.Use(tracing.Middleware())
+	r.Use(logging.Middleware())
+	r.Use(metrics.Middleware())
+	r.Use(authn.Middleware())
+	r.Use(authn.Authorize("order-service"))
 
 	r.POST("/order", createOrder)
-	r.GET("/health", healthCheck)
+	healthChecker.Register(r)
+	metrics.Register(r)
+	config.Register(r, cfg)
 
-	log.Println("Order Service starting on :8080")
-	r.Run(":8080")
+	slog.Info("Order Service starting", "addr", cfg.Addr())
+	r.Run(cfg.Addr())
 }
\ No newline at end of file
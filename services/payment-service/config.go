@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"shared/auth"
+	"shared/config"
+	"shared/kafkaconn"
+	"shared/logging"
+)
+
+type Config struct {
+	config.Common `yaml:",inline"`
+
+	// FailureRate is the share of simulated payments the bank declines.
+	FailureRate     float64       `yaml:"failure_rate" env:"PAYMENT_FAILURE_RATE"`
+	ProcessingDelay time.Duration `yaml:"processing_delay" env:"PAYMENT_PROCESSING_DELAY"`
+}
+
+func (c Config) Validate() error {
+	errs := []error{c.Common.Validate()}
+	if c.FailureRate < 0 || c.FailureRate > 1 {
+		errs = append(errs, fmt.Errorf("failure_rate %g must be between 0 and 1", c.FailureRate))
+	}
+	if c.ProcessingDelay < 0 {
+		errs = append(errs, fmt.Errorf("processing_delay %s is negative", c.ProcessingDelay))
+	}
+	return errors.Join(errs...)
+}
+
+// cfg is initialised before any other package state that reads it, so an
+// invalid configuration stops the service before it touches Kafka.
+var cfg = loadConfig()
+
+// kafkaConn carries the broker, TLS and SASL settings to every Kafka client.
+var kafkaConn = kafkaconn.MustNew(cfg.Kafka)
+
+// authn validates the bearer tokens of API requests.
+var authn = auth.MustNew(cfg.Auth)
+
+func loadConfig() *Config {
+	logging.Init("payment-service")
+
+	c := &Config{
+		Common:          config.Defaults("payment-service", 8084),
+		FailureRate:     0.05,
+		ProcessingDelay: 100 * time.Millisecond,
+	}
+	config.MustLoad(c)
+	return c
+}
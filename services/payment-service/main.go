@@ -3,14 +3,20 @@ package main
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"log/slog"
 	"math/rand"
 	"net/http"
-	"os"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/segmentio/kafka-go"
+
+	"shared/config"
+	"shared/health"
+	"shared/lag"
+	"shared/logging"
+	"shared/metrics"
+	"shared/tracing"
 )
 
 type InventoryEvent struct {
@@ -37,19 +43,14 @@ var productPrices = map[string]float64{
 	"product-3": 99.99,
 }
 
-func getKafkaBroker() string {
-	if broker := os.Getenv("KAFKA_BROKER"); broker != "" {
-		return broker
-	}
-	return "localhost:9092"
-}
+// healthChecker backs /health, /health/live and /health/ready.
+var healthChecker = health.New("payment-service")
 
-func publishPaymentEvent(event PaymentEvent) error {
-	writer := &kafka.Writer{
-		Addr:     kafka.TCP(getKafkaBroker()),
-		Topic:    "payment",
-		Balancer: &kafka.LeastBytes{},
-	}
+// lagTracker backs /consumer/lag.
+var lagTracker = lag.NewTracker("payment-service", cfg.Kafka.GroupID, kafkaConn, cfg.Kafka.Topics.Inventory)
+
+func publishPaymentEvent(ctx context.Context, event PaymentEvent) error {
+	writer := kafkaConn.Writer(cfg.Kafka.Topics.Payment)
 	defer writer.Close()
 
 	eventBytes, err := json.Marshal(event)
@@ -57,16 +58,25 @@ func publishPaymentEvent(event PaymentEvent) error {
 		return err
 	}
 
-	return writer.WriteMessages(context.Background(),
-		kafka.Message{
-			Key:   []byte(event.OrderID),
-			Value: eventBytes,
-		},
-	)
+	msg := kafka.Message{
+		Key:   []byte(event.OrderID),
+		Value: eventBytes,
+	}
+
+	ctx, span := tracing.StartPublish(ctx, cfg.Kafka.Topics.Payment, &msg)
+	ctx = logging.WithEventID(ctx, logging.EventID(eventBytes))
+	start := time.Now()
+	err = writer.WriteMessages(ctx, msg)
+	metrics.ObservePublish(cfg.Kafka.Topics.Payment, start, err)
+	tracing.End(span, err)
+	if err == nil {
+		slog.DebugContext(ctx, "Event published", "topic", cfg.Kafka.Topics.Payment)
+	}
+	return err
 }
 
-func processPayment(orderID, productID string, quantity int) PaymentEvent {
-	time.Sleep(100 * time.Millisecond)
+func processPayment(ctx context.Context, orderID, productID string, quantity int) PaymentEvent {
+	time.Sleep(cfg.ProcessingDelay)
 
 	price, exists := productPrices[productID]
 	if !exists {
@@ -82,55 +92,71 @@ func processPayment(orderID, productID string, quantity int) PaymentEvent {
 		ProcessedAt: time.Now(),
 	}
 
-	if rand.Float32() < 0.95 {
+	if rand.Float64() >= cfg.FailureRate {
 		event.EventType = "PaymentCompleted"
-		log.Printf("Payment completed for order: %s, amount: $%.2f", orderID, amount)
+		slog.InfoContext(ctx, "Payment completed", "amount", amount)
 	} else {
 		event.EventType = "PaymentFailed"
 		event.Reason = "Payment declined by bank"
-		log.Printf("Payment failed for order: %s - %s", orderID, event.Reason)
+		metrics.PaymentsFailed.WithLabelValues(event.Reason).Inc()
+		slog.WarnContext(ctx, "Payment failed", "amount", amount, "reason", event.Reason)
 	}
 
 	return event
 }
 
-func processInventoryEvent(event InventoryEvent) {
+func processInventoryEvent(ctx context.Context, event InventoryEvent) {
 	if event.EventType != "InventoryConfirmed" {
-		log.Printf("Ignoring inventory event: %s for order: %s", event.EventType, event.OrderID)
+		slog.DebugContext(ctx, "Ignoring inventory event", "event_type", event.EventType)
 		return
 	}
 
-	log.Printf("Processing payment for order: %s", event.OrderID)
+	slog.InfoContext(ctx, "Processing payment")
 
-	paymentEvent := processPayment(event.OrderID, event.ProductID, event.Quantity)
+	paymentEvent := processPayment(ctx, event.OrderID, event.ProductID, event.Quantity)
 
-	if err := publishPaymentEvent(paymentEvent); err != nil {
-		log.Printf("Failed to publish payment event: %v", err)
+	if err := publishPaymentEvent(ctx, paymentEvent); err != nil {
+		slog.ErrorContext(ctx, "Failed to publish payment event", "error", err)
 	}
 }
 
 func consumeInventoryEvents() {
-	reader := kafka.NewReader(kafka.ReaderConfig{
-		Brokers: []string{getKafkaBroker()},
-		Topic:   "inventory",
-		GroupID: "payment-service",
+	loop := healthChecker.Loop("consume-inventory")
+	loop.Run()
+	defer loop.Exit()
+
+	reader := kafkaConn.Reader(kafka.ReaderConfig{
+		Topic:   cfg.Kafka.Topics.Inventory,
+		GroupID: cfg.Kafka.GroupID,
 	})
 	defer reader.Close()
 
 	for {
 		msg, err := reader.ReadMessage(context.Background())
 		if err != nil {
-			log.Printf("Error reading message: %v", err)
+			slog.Error("Error reading message", "topic", cfg.Kafka.Topics.Inventory, "error", err)
+			loop.Fail(err)
 			continue
 		}
+		loop.Beat()
+		ctx, span := tracing.StartConsume(msg)
+		ctx = logging.WithEventID(ctx, logging.EventID(msg.Value))
+		start := time.Now()
 
 		var event InventoryEvent
 		if err := json.Unmarshal(msg.Value, &event); err != nil {
-			log.Printf("Error unmarshaling message: %v", err)
+			slog.ErrorContext(ctx, "Error unmarshaling message", "topic", msg.Topic, "error", err)
+			metrics.ObserveConsume(msg.Topic, start, err)
+			tracing.End(span, err)
 			continue
 		}
 
-		processInventoryEvent(event)
+		ctx = logging.WithOrderID(ctx, event.OrderID)
+		tracing.OrderID(ctx, event.OrderID)
+		processInventoryEvent(ctx, event)
+		metrics.ObserveConsume(msg.Topic, start, nil)
+		tracing.End(span, nil)
+		lagTracker.Processed(msg)
 	}
 }
 
@@ -140,19 +166,30 @@ func getProductPrices(c *gin.Context) {
 	})
 }
 
-func healthCheck(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"status": "healthy", "service": "payment-service"})
-}
-
 func main() {
+	metrics.Init("payment-service", metrics.PaymentsFailed)
+	tracing.Init("payment-service")
+	kafkaConn.MustEnsureTopics(context.Background())
+
+	healthChecker.AddCheck("kafka", health.KafkaCheck(kafkaConn))
+
 	rand.Seed(time.Now().UnixNano())
 	
 	go consumeInventoryEvents()
 
-	r := gin.Default()
+	r := gin.New()
+	r.Use(gin.Recovery())
+	r.Use(tracing.Middleware())
+	r.Use(logging.Middleware())
+	r.Use(metrics.Middleware())
+	r.Use(authn.Middleware())
+	r.Use(authn.Authorize("payment-service"))
 	r.GET("/prices", getProductPrices)
-	r.GET("/health", healthCheck)
+	healthChecker.Register(r)
+	metrics.Register(r)
+	config.Register(r, cfg)
+	lagTracker.Register(r)
 
-	log.Printf("Payment Service starting on port :8084")
-	r.Run(":8084")
+	slog.Info("Payment Service starting", "addr", cfg.Addr())
+	r.Run(cfg.Addr())
 }
\ No newline at end of file
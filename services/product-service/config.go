@@ -0,0 +1,41 @@
+package main
+
+import (
+	"shared/auth"
+	"shared/config"
+	"shared/kafkaconn"
+	"shared/logging"
+)
+
+type Config struct {
+	config.Common `yaml:",inline"`
+
+	Features Features `yaml:"features"`
+}
+
+type Features struct {
+	// AutoCreateTopics lets the producer create the products topic if the
+	// broker does not have it.
+	AutoCreateTopics bool `yaml:"auto_create_topics" env:"FEATURE_AUTO_CREATE_TOPICS"`
+}
+
+// cfg is initialised before any other package state that reads it, so an
+// invalid configuration stops the service before it touches Kafka.
+var cfg = loadConfig()
+
+// kafkaConn carries the broker, TLS and SASL settings to every Kafka client.
+var kafkaConn = kafkaconn.MustNew(cfg.Kafka)
+
+// authn validates the bearer tokens of API requests.
+var authn = auth.MustNew(cfg.Auth)
+
+func loadConfig() *Config {
+	logging.Init("product-service")
+
+	c := &Config{
+		Common:   config.Defaults("product-service", 8082),
+		Features: Features{AutoCreateTopics: true},
+	}
+	config.MustLoad(c)
+	return c
+}
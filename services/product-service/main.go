@@ -3,8 +3,9 @@ package main
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
 	"strings"
 	"sync"
 	"time"
@@ -12,6 +13,13 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/segmentio/kafka-go"
+
+	"shared/audit"
+	"shared/config"
+	"shared/health"
+	"shared/logging"
+	"shared/metrics"
+	"shared/tracing"
 )
 
 // Product represents a product in the catalog
@@ -66,25 +74,24 @@ var (
 	mutex      = sync.RWMutex{}
 )
 
-// Kafka configuration
-const kafkaBroker = "kafka:9092"
+// healthChecker backs /health, /health/live and /health/ready.
+var healthChecker = health.New("product-service")
 
 // Kafka writer
 var kafkaWriter *kafka.Writer
 
+// auditor publishes an AdminActionPerformed event for every admin change.
+var auditor = audit.NewPublisher("product-service", kafkaConn, cfg.Kafka.Topics.Audit)
+
 func init() {
 	// Initialize Kafka writer
-	kafkaWriter = &kafka.Writer{
-		Addr:                   kafka.TCP(kafkaBroker),
-		Topic:                  "products",
-		Balancer:               &kafka.LeastBytes{},
-		AllowAutoTopicCreation: true,
-	}
+	kafkaWriter = kafkaConn.Writer(cfg.Kafka.Topics.Products)
+	kafkaWriter.AllowAutoTopicCreation = cfg.Features.AutoCreateTopics
 
 	// Initialize default products
 	initializeDefaultData()
 	
-	log.Println("Product Service initialized with default data")
+	slog.Info("Product Service initialized with default data", "products", len(products))
 }
 
 func initializeDefaultData() {
@@ -147,7 +154,7 @@ func initializeDefaultData() {
 	}
 }
 
-func publishProductEvent(event interface{}) error {
+func publishProductEvent(ctx context.Context, event interface{}) error {
 	eventBytes, err := json.Marshal(event)
 	if err != nil {
 		return err
@@ -159,7 +166,12 @@ func publishProductEvent(event interface{}) error {
 		Time:  time.Now(),
 	}
 
-	return kafkaWriter.WriteMessages(context.Background(), message)
+	ctx, span := tracing.StartPublish(ctx, cfg.Kafka.Topics.Products, &message)
+	start := time.Now()
+	err = kafkaWriter.WriteMessages(ctx, message)
+	metrics.ObservePublish(cfg.Kafka.Topics.Products, start, err)
+	tracing.End(span, err)
+	return err
 }
 
 // Product endpoints
@@ -223,11 +235,12 @@ func createProduct(c *gin.Context) {
 		Timestamp:  time.Now(),
 	}
 
-	if err := publishProductEvent(event); err != nil {
-		log.Printf("Failed to publish product created event: %v", err)
+	if err := publishProductEvent(c.Request.Context(), event); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to publish product created event", "product_id", newProduct.ID, "error", err)
 	}
+	auditor.Record(c, "product.create", "product/"+newProduct.ID, nil, newProduct)
 
-	log.Printf("Product created: %s", newProduct.ID)
+	slog.InfoContext(c.Request.Context(), "Product created", "product_id", newProduct.ID)
 	c.JSON(http.StatusCreated, newProduct)
 }
 
@@ -248,6 +261,7 @@ func updateProduct(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	before := existingProduct
 
 	// Update product fields
 	existingProduct.Name = updateData.Name
@@ -270,11 +284,12 @@ func updateProduct(c *gin.Context) {
 		Timestamp:  time.Now(),
 	}
 
-	if err := publishProductEvent(event); err != nil {
-		log.Printf("Failed to publish product updated event: %v", err)
+	if err := publishProductEvent(c.Request.Context(), event); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to publish product updated event", "product_id", productID, "error", err)
 	}
+	auditor.Record(c, "product.update", "product/"+productID, before, existingProduct)
 
-	log.Printf("Product updated: %s", productID)
+	slog.InfoContext(c.Request.Context(), "Product updated", "product_id", productID)
 	c.JSON(http.StatusOK, existingProduct)
 }
 
@@ -291,11 +306,13 @@ func deleteProduct(c *gin.Context) {
 	}
 
 	// Soft delete by setting IsActive to false
+	before := product
 	product.IsActive = false
 	product.UpdatedAt = time.Now()
 	products[productID] = product
+	auditor.Record(c, "product.deactivate", "product/"+productID, before, product)
 
-	log.Printf("Product deactivated: %s", productID)
+	slog.InfoContext(c.Request.Context(), "Product deactivated", "product_id", productID)
 	c.JSON(http.StatusOK, gin.H{"message": "Product deactivated successfully"})
 }
 
@@ -334,8 +351,9 @@ func createCategory(c *gin.Context) {
 	mutex.Lock()
 	categories[newCategory.ID] = newCategory
 	mutex.Unlock()
+	auditor.Record(c, "category.create", "category/"+newCategory.ID, nil, newCategory)
 
-	log.Printf("Category created: %s", newCategory.ID)
+	slog.InfoContext(c.Request.Context(), "Category created", "category_id", newCategory.ID)
 	c.JSON(http.StatusCreated, newCategory)
 }
 
@@ -380,19 +398,20 @@ func searchProducts(c *gin.Context) {
 	})
 }
 
-// Health check endpoint
-func healthCheck(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"status":    "healthy",
-		"service":   "product-service",
-		"timestamp": time.Now(),
-		"version":   "1.0.0",
-	})
-}
-
 func main() {
+	metrics.Init("product-service")
+	tracing.Init("product-service")
+	kafkaConn.MustEnsureTopics(context.Background())
+	go auditor.CheckTopic(context.Background())
+
+	healthChecker.AddCheck("kafka", health.KafkaCheck(kafkaConn))
+
 	// Create Gin router
-	r := gin.Default()
+	r := gin.New()
+	r.Use(gin.Recovery())
+	r.Use(tracing.Middleware())
+	r.Use(logging.Middleware())
+	r.Use(metrics.Middleware())
 
 	// CORS middleware
 	r.Use(func(c *gin.Context) {
@@ -407,9 +426,13 @@ func main() {
 
 		c.Next()
 	})
+	r.Use(authn.Middleware())
+	r.Use(authn.Authorize("product-service"))
 
 	// Routes
-	r.GET("/health", healthCheck)
+	healthChecker.Register(r)
+	metrics.Register(r)
+	config.Register(r, cfg)
 	
 	// Product routes
 	r.GET("/products", getProducts)
@@ -424,11 +447,10 @@ func main() {
 	r.POST("/categories", createCategory)
 
 	// Start server
-	port := ":8082"
-	log.Printf("Product Service starting on port %s", port)
-	log.Printf("Kafka broker: %s", kafkaBroker)
+	slog.Info("Product Service starting", "addr", cfg.Addr(), "kafka_brokers", cfg.Kafka.Brokers)
 	
-	if err := r.Run(port); err != nil {
-		log.Fatal("Failed to start server:", err)
+	if err := r.Run(cfg.Addr()); err != nil {
+		slog.Error("Failed to start server", "error", err)
+		os.Exit(1)
 	}
 }
\ No newline at end of file
@@ -0,0 +1,161 @@
+// Package audit publishes an AdminActionPerformed event for every change made
+// through an admin API, so management-service can keep one audit log for all
+// services.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/segmentio/kafka-go"
+
+	"shared/auth"
+	"shared/kafkaconn"
+	"shared/logging"
+	"shared/metrics"
+	"shared/tracing"
+)
+
+// EventType is the event_type of audit events.
+const EventType = "AdminActionPerformed"
+
+// Event describes one admin action. Before and After are snapshots of the
+// resource; Before is empty for creations and After for deletions.
+type Event struct {
+	EventID    string          `json:"event_id"`
+	EventType  string          `json:"event_type"`
+	Service    string          `json:"service"`
+	Action     string          `json:"action"`
+	Resource   string          `json:"resource"`
+	Actor      string          `json:"actor"`
+	ActorRoles []string        `json:"actor_roles"`
+	IPAddress  string          `json:"ip_address"`
+	Method     string          `json:"method"`
+	Path       string          `json:"path"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+	Changes    []Change        `json:"changes"`
+	OccurredAt time.Time       `json:"occurred_at"`
+}
+
+// Change is one top-level field that differs between Before and After.
+type Change struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// Publisher writes audit events for one service.
+type Publisher struct {
+	service string
+	topic   string
+	conn    *kafkaconn.Conn
+	writer  *kafka.Writer
+}
+
+func NewPublisher(service string, conn *kafkaconn.Conn, topic string) *Publisher {
+	return &Publisher{service: service, topic: topic, conn: conn, writer: conn.Writer(topic)}
+}
+
+// CheckTopic logs a warning if the audit topic is missing or has more than
+// one partition. Publishing does not depend on either, so the service keeps
+// running; management-service refuses to start on such a topic instead.
+func (p *Publisher) CheckTopic(ctx context.Context) {
+	if err := p.conn.CheckAuditTopic(ctx); err != nil {
+		slog.WarnContext(ctx, "Kafka audit topic is not usable by management-service", "topic", p.topic, "error", err)
+	}
+}
+
+// Record publishes the action the request in c performed on resource. The
+// actor is the authenticated subject, or "anonymous" when authentication is
+// disabled. A failed publish is logged and returned; most callers go on
+// regardless, since the change has already been made.
+func (p *Publisher) Record(c *gin.Context, action, resource string, before, after interface{}) error {
+	ctx := c.Request.Context()
+
+	actor := auth.Subject(c)
+	if actor == "" {
+		actor = "anonymous"
+	}
+	event := Event{
+		EventID:    uuid.New().String(),
+		EventType:  EventType,
+		Service:    p.service,
+		Action:     action,
+		Resource:   resource,
+		Actor:      actor,
+		ActorRoles: auth.Roles(c),
+		IPAddress:  c.ClientIP(),
+		Method:     c.Request.Method,
+		Path:       c.Request.URL.Path,
+		Before:     snapshot(before),
+		After:      snapshot(after),
+		OccurredAt: time.Now(),
+	}
+	event.Changes = Diff(event.Before, event.After)
+
+	eventBytes, err := json.Marshal(event)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to encode audit event", "action", action, "error", err)
+		return err
+	}
+	msg := kafka.Message{Key: []byte(resource), Value: eventBytes}
+
+	ctx, span := tracing.StartPublish(ctx, p.topic, &msg)
+	ctx = logging.WithEventID(ctx, logging.EventID(eventBytes))
+	start := time.Now()
+	err = p.writer.WriteMessages(ctx, msg)
+	metrics.ObservePublish(p.topic, start, err)
+	tracing.End(span, err)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to publish audit event", "action", action, "resource", resource, "error", err)
+		return err
+	}
+	slog.DebugContext(ctx, "Event published", "topic", p.topic)
+	return nil
+}
+
+// Diff compares the top-level fields of two JSON objects. Either side may be
+// empty, in which case every field of the other side is a change.
+func Diff(before, after json.RawMessage) []Change {
+	var b, a map[string]interface{}
+	json.Unmarshal(before, &b)
+	json.Unmarshal(after, &a)
+
+	fields := map[string]bool{}
+	for field := range b {
+		fields[field] = true
+	}
+	for field := range a {
+		fields[field] = true
+	}
+
+	changes := []Change{}
+	for field := range fields {
+		if !reflect.DeepEqual(b[field], a[field]) {
+			changes = append(changes, Change{Field: field, Before: b[field], After: a[field]})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes
+}
+
+func snapshot(v interface{}) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Pointer && rv.IsNil() {
+		return nil
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return raw
+}
@@ -0,0 +1,260 @@
+// Package auth authenticates API requests with JWT bearer tokens.
+//
+// An Authenticator validates HS256 tokens against a shared secret or RS256
+// tokens against the keys of a JWKS file, and stores the token's subject and
+// roles in the gin context for the handlers and later middleware.
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+
+	"shared/config"
+)
+
+// Keys of the gin context values set for authenticated requests.
+const (
+	SubjectKey = "auth.subject"
+	RolesKey   = "auth.roles"
+)
+
+// Authenticator validates bearer tokens.
+type Authenticator struct {
+	enabled    bool
+	parser     *jwt.Parser
+	keyfunc    jwt.Keyfunc
+	rolesClaim []string
+}
+
+// New loads the key material named by cfg.
+func New(cfg config.Auth) (*Authenticator, error) {
+	if !cfg.Enabled {
+		return &Authenticator{}, nil
+	}
+
+	var keyfunc jwt.Keyfunc
+	switch cfg.Algorithm {
+	case "HS256":
+		secret := []byte(cfg.Secret)
+		if cfg.SecretFile != "" {
+			raw, err := os.ReadFile(cfg.SecretFile)
+			if err != nil {
+				return nil, fmt.Errorf("read JWT secret: %w", err)
+			}
+			secret = []byte(strings.TrimRight(string(raw), "\r\n"))
+		}
+		if len(secret) == 0 {
+			return nil, errors.New("JWT secret is empty")
+		}
+		keyfunc = func(*jwt.Token) (interface{}, error) { return secret, nil }
+	case "RS256":
+		keys, err := loadJWKS(cfg.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		keyfunc = keys.keyfunc
+	default:
+		return nil, fmt.Errorf("unsupported JWT algorithm %q", cfg.Algorithm)
+	}
+
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{cfg.Algorithm}),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(cfg.Leeway),
+	}
+	if cfg.Issuer != "" {
+		options = append(options, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		options = append(options, jwt.WithAudience(cfg.Audience))
+	}
+	return &Authenticator{
+		enabled:    true,
+		parser:     jwt.NewParser(options...),
+		keyfunc:    keyfunc,
+		rolesClaim: strings.Split(cfg.RolesClaim, "."),
+	}, nil
+}
+
+// MustNew is New for package initialisation: a key that cannot be loaded
+// stops the service.
+func MustNew(cfg config.Auth) *Authenticator {
+	a, err := New(cfg)
+	if err != nil {
+		slog.Error("Invalid authentication settings", "error", err)
+		os.Exit(1)
+	}
+	return a
+}
+
+// Middleware authenticates every request that carries a bearer token and
+// rejects requests to protected routes that do not. A route is protected when
+// its method changes state or its path starts with one of adminPrefixes.
+// An invalid token is rejected on any route. With authentication disabled
+// every request passes.
+func (a *Authenticator) Middleware(adminPrefixes ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !a.enabled {
+			c.Next()
+			return
+		}
+
+		header := c.GetHeader("Authorization")
+		if header == "" {
+			if protected(c, adminPrefixes) {
+				unauthorized(c, "authentication required")
+				return
+			}
+			c.Next()
+			return
+		}
+
+		raw, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok {
+			unauthorized(c, "authorization header is not a bearer token")
+			return
+		}
+		claims := jwt.MapClaims{}
+		if _, err := a.parser.ParseWithClaims(strings.TrimSpace(raw), claims, a.keyfunc); err != nil {
+			unauthorized(c, "invalid token: "+err.Error())
+			return
+		}
+		subject, _ := claims.GetSubject()
+		if subject == "" {
+			unauthorized(c, "token has no subject")
+			return
+		}
+
+		c.Set(SubjectKey, subject)
+		c.Set(RolesKey, a.roles(claims))
+		c.Next()
+	}
+}
+
+// Subject is the authenticated subject of the request, or "" if the request
+// carried no token.
+func Subject(c *gin.Context) string {
+	return c.GetString(SubjectKey)
+}
+
+// Roles are the roles of the authenticated subject.
+func Roles(c *gin.Context) []string {
+	return c.GetStringSlice(RolesKey)
+}
+
+func protected(c *gin.Context, adminPrefixes []string) bool {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+	default:
+		return true
+	}
+	for _, prefix := range adminPrefixes {
+		if strings.HasPrefix(c.Request.URL.Path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func unauthorized(c *gin.Context, message string) {
+	c.Header("WWW-Authenticate", `Bearer realm="api"`)
+	c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": message})
+}
+
+// roles reads the roles claim, which may be a list or a space separated
+// string, following the dotted path of the configured claim name.
+func (a *Authenticator) roles(claims jwt.MapClaims) []string {
+	var value interface{} = map[string]interface{}(claims)
+	for _, key := range a.rolesClaim {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return []string{}
+		}
+		value = object[key]
+	}
+
+	roles := []string{}
+	switch v := value.(type) {
+	case string:
+		roles = append(roles, strings.Fields(v)...)
+	case []interface{}:
+		for _, item := range v {
+			if role, ok := item.(string); ok {
+				roles = append(roles, role)
+			}
+		}
+	}
+	return roles
+}
+
+// jwks holds the RSA keys of a JWKS file by key ID.
+type jwks map[string]*rsa.PublicKey
+
+func loadJWKS(path string) (jwks, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read JWKS: %w", err)
+	}
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return nil, fmt.Errorf("parse JWKS %s: %w", path, err)
+	}
+
+	keys := make(jwks)
+	for _, key := range set.Keys {
+		if key.Kty != "RSA" || (key.Use != "" && key.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(key.N)
+		if err != nil {
+			return nil, fmt.Errorf("JWKS key %q: modulus: %w", key.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(key.E)
+		if err != nil {
+			return nil, fmt.Errorf("JWKS key %q: exponent: %w", key.Kid, err)
+		}
+		keys[key.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("JWKS %s has no RSA signing keys", path)
+	}
+	return keys, nil
+}
+
+// keyfunc picks the key named by the token's kid header. Tokens without a kid
+// are accepted only when the set has a single key.
+func (k jwks) keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" && len(k) == 1 {
+		for _, key := range k {
+			return key, nil
+		}
+	}
+	key, ok := k[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	return key, nil
+}
@@ -0,0 +1,54 @@
+package auth
+
+// Routes is the permission each restricted route requires, by service and
+// "METHOD /path" as the route is registered with gin. Routes that are not
+// listed need only what Middleware asks for: a valid token on mutating and
+// admin routes, nothing otherwise.
+var Routes = map[string]map[string]Permission{
+	"inventory-service": {
+		"POST /products":                 InventoryWrite,
+		"PUT /products/:id/stock":        InventoryWrite,
+		"PUT /products/:id/alert/:level": InventoryWrite,
+	},
+	"product-service": {
+		"POST /products":       CatalogWrite,
+		"PUT /products/:id":    CatalogWrite,
+		"DELETE /products/:id": CatalogWrite,
+		"POST /categories":     CatalogWrite,
+	},
+	"notification-service": {
+		"POST /notifications": NotificationsSend,
+	},
+	"status-service": {
+		"DELETE /orders/:orderId":  OrdersDelete,
+		"POST /orders/bulk-delete": OrdersBulkDelete,
+		"POST /admin/rebuild":      SystemRebuild,
+		"GET /admin/rebuild":       SystemRead,
+	},
+	"management-service": {
+		"GET /dashboard/metrics":          DashboardRead,
+		"GET /dashboard/charts":           DashboardRead,
+		"GET /analytics/orders":           AnalyticsRead,
+		"GET /analytics/products":         AnalyticsRead,
+		"GET /analytics/revenue":          AnalyticsRead,
+		"POST /reports/generate":          ReportsWrite,
+		"GET /reports/schedules":          ReportsRead,
+		"POST /reports/schedules":         ReportsWrite,
+		"GET /reports/schedules/:id":      ReportsRead,
+		"PUT /reports/schedules/:id":      ReportsWrite,
+		"DELETE /reports/schedules/:id":   ReportsWrite,
+		"POST /reports/schedules/:id/run": ReportsWrite,
+		"GET /reports/schedules/:id/runs": ReportsRead,
+		"GET /reports/:id":                ReportsRead,
+		"GET /reports/:id/download":       ReportsRead,
+		"GET /system/health":              SystemRead,
+		"GET /system/consumer-lag":        SystemRead,
+		"GET /system/alerts":              SystemRead,
+		"POST /system/alerts":             SystemAlertsWrite,
+		"GET /admin/logs":                 AuditRead,
+		"GET /admin/logs/export":          AuditRead,
+		"GET /admin/logs/verify":          AuditRead,
+		"POST /admin/logs/verify":         AuditRead,
+		"POST /admin/logs":                AuditWrite,
+	},
+}
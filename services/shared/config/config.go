@@ -0,0 +1,474 @@
+// Package config loads a service's configuration from defaults, an optional
+// YAML file and environment variables, in that order of precedence, and
+// validates it before the service starts.
+//
+// A service describes its settings as a struct embedding Common:
+//
+//	type Config struct {
+//		config.Common `yaml:",inline"`
+//		FailureRate   float64 `yaml:"failure_rate" env:"PAYMENT_FAILURE_RATE"`
+//	}
+//
+// Fields are read from the YAML key in their yaml tag and overridden by the
+// environment variable in their env tag, or failing that the one in their
+// deprecated tag, which logs a warning. Fields tagged secret:"true" are
+// masked by the /config endpoint. If the struct has a Validate method it is
+// called after loading; Common's is promoted otherwise.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+// FileEnv names the environment variable holding the optional YAML file.
+const FileEnv = "CONFIG_FILE"
+
+// Common holds the settings every service has.
+type Common struct {
+	Service string `yaml:"-"`
+	Port    int    `yaml:"port" env:"PORT"`
+	Kafka   Kafka  `yaml:"kafka"`
+	Auth    Auth   `yaml:"auth"`
+}
+
+type Kafka struct {
+	// Brokers are the bootstrap addresses; any one of them being reachable
+	// is enough to discover the rest of the cluster. KAFKA_BROKER is the
+	// single-broker variable the services read before KAFKA_BROKERS.
+	Brokers      []string      `yaml:"brokers" env:"KAFKA_BROKERS" deprecated:"KAFKA_BROKER"`
+	GroupID      string        `yaml:"group_id" env:"KAFKA_GROUP_ID"`
+	Topics       Topics        `yaml:"topics"`
+	Provision    Provision     `yaml:"provision"`
+	WriteTimeout time.Duration `yaml:"write_timeout" env:"KAFKA_WRITE_TIMEOUT"`
+	TLS          TLS           `yaml:"tls"`
+	SASL         SASL          `yaml:"sasl"`
+}
+
+// Provision describes the topics every service checks for at startup. Each
+// topic in Topics, and its dead letter topic named with DLQSuffix, must exist
+// with at least Partitions partitions, ReplicationFactor replicas and
+// Retention (unlimited retention satisfies any); missing topics are created
+// with exactly those when Create is set. The audit topic is the record of
+// admin actions and is kept forever instead, in a single partition so its
+// order is fixed; management-service checks its partition count even when
+// Enabled is off.
+type Provision struct {
+	Enabled           bool          `yaml:"enabled" env:"KAFKA_PROVISION_ENABLED"`
+	Create            bool          `yaml:"create" env:"KAFKA_PROVISION_CREATE"`
+	Partitions        int           `yaml:"partitions" env:"KAFKA_TOPIC_PARTITIONS"`
+	ReplicationFactor int           `yaml:"replication_factor" env:"KAFKA_TOPIC_REPLICATION_FACTOR"`
+	Retention         time.Duration `yaml:"retention" env:"KAFKA_TOPIC_RETENTION"`
+	DLQSuffix         string        `yaml:"dlq_suffix" env:"KAFKA_DLQ_SUFFIX"`
+	Timeout           time.Duration `yaml:"timeout" env:"KAFKA_PROVISION_TIMEOUT"`
+}
+
+// TLS secures the broker connections. CAFile adds a CA to the system pool;
+// CertFile and KeyFile present a client certificate for mutual TLS.
+type TLS struct {
+	Enabled            bool   `yaml:"enabled" env:"KAFKA_TLS_ENABLED"`
+	CAFile             string `yaml:"ca_file" env:"KAFKA_TLS_CA_FILE"`
+	CertFile           string `yaml:"cert_file" env:"KAFKA_TLS_CERT_FILE"`
+	KeyFile            string `yaml:"key_file" env:"KAFKA_TLS_KEY_FILE"`
+	ServerName         string `yaml:"server_name" env:"KAFKA_TLS_SERVER_NAME"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify" env:"KAFKA_TLS_INSECURE_SKIP_VERIFY"`
+}
+
+// SASL authenticates to the brokers with PLAIN, SCRAM-SHA-256 or
+// SCRAM-SHA-512. The password is read from PasswordFile when set, which suits
+// mounted secrets.
+type SASL struct {
+	Mechanism    string `yaml:"mechanism" env:"KAFKA_SASL_MECHANISM"`
+	Username     string `yaml:"username" env:"KAFKA_SASL_USERNAME"`
+	Password     string `yaml:"password" env:"KAFKA_SASL_PASSWORD" secret:"true"`
+	PasswordFile string `yaml:"password_file" env:"KAFKA_SASL_PASSWORD_FILE"`
+}
+
+// SASLMechanisms are the accepted values of SASL.Mechanism; empty disables
+// SASL.
+var SASLMechanisms = []string{"PLAIN", "SCRAM-SHA-256", "SCRAM-SHA-512"}
+
+// Auth configures JWT validation of API requests. HS256 tokens are checked
+// against Secret (or the contents of SecretFile), RS256 tokens against the keys
+// in JWKSFile. Issuer and Audience are only checked when set. It is on by
+// default, and a service with it on but no key refuses to start; only the
+// development compose files turn it off.
+type Auth struct {
+	Enabled    bool          `yaml:"enabled" env:"AUTH_ENABLED"`
+	Algorithm  string        `yaml:"algorithm" env:"AUTH_JWT_ALGORITHM"`
+	Secret     string        `yaml:"secret" env:"AUTH_JWT_SECRET" secret:"true"`
+	SecretFile string        `yaml:"secret_file" env:"AUTH_JWT_SECRET_FILE"`
+	JWKSFile   string        `yaml:"jwks_file" env:"AUTH_JWKS_FILE"`
+	Issuer     string        `yaml:"issuer" env:"AUTH_JWT_ISSUER"`
+	Audience   string        `yaml:"audience" env:"AUTH_JWT_AUDIENCE"`
+	RolesClaim string        `yaml:"roles_claim" env:"AUTH_ROLES_CLAIM"` // dotted path, e.g. realm_access.roles
+	Leeway     time.Duration `yaml:"leeway" env:"AUTH_LEEWAY"`
+}
+
+// Topics are the names of the order lifecycle and catalogue topics.
+type Topics struct {
+	Orders       string `yaml:"orders" env:"TOPIC_ORDERS"`
+	Inventory    string `yaml:"inventory" env:"TOPIC_INVENTORY"`
+	Payment      string `yaml:"payment" env:"TOPIC_PAYMENT"`
+	Notification string `yaml:"notification" env:"TOPIC_NOTIFICATION"`
+	Shipping     string `yaml:"shipping" env:"TOPIC_SHIPPING"`
+	Products     string `yaml:"products" env:"TOPIC_PRODUCTS"`
+	Audit        string `yaml:"audit" env:"TOPIC_AUDIT"`
+}
+
+// Defaults returns the Common settings for service listening on port. The
+// consumer group defaults to the service name.
+func Defaults(service string, port int) Common {
+	return Common{
+		Service: service,
+		Port:    port,
+		Kafka: Kafka{
+			Brokers: []string{"localhost:9092"},
+			GroupID: service,
+			Topics: Topics{
+				Orders:       "orders",
+				Inventory:    "inventory",
+				Payment:      "payment",
+				Notification: "notification",
+				Shipping:     "shipping",
+				Products:     "products",
+				Audit:        "audit",
+			},
+			Provision: Provision{
+				Enabled:           true,
+				Create:            true,
+				Partitions:        3,
+				ReplicationFactor: 1,
+				Retention:         7 * 24 * time.Hour,
+				DLQSuffix:         ".dlq",
+				Timeout:           time.Minute,
+			},
+			WriteTimeout: 10 * time.Second,
+		},
+		Auth: Auth{
+			Enabled:    true,
+			Algorithm:  "HS256",
+			RolesClaim: "roles",
+			Leeway:     30 * time.Second,
+		},
+	}
+}
+
+// Addr is the address the HTTP server listens on.
+func (c Common) Addr() string {
+	return fmt.Sprintf(":%d", c.Port)
+}
+
+func (c Common) Validate() error {
+	var errs []error
+	if c.Port < 1 || c.Port > 65535 {
+		errs = append(errs, fmt.Errorf("port %d is out of range", c.Port))
+	}
+	if len(c.Kafka.Brokers) == 0 {
+		errs = append(errs, errors.New("kafka.brokers is empty"))
+	}
+	for _, broker := range c.Kafka.Brokers {
+		if _, _, err := net.SplitHostPort(broker); err != nil {
+			errs = append(errs, fmt.Errorf("kafka.brokers %q: %w", broker, err))
+		}
+	}
+	if c.Kafka.GroupID == "" {
+		errs = append(errs, errors.New("kafka.group_id is empty"))
+	}
+	if c.Kafka.WriteTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("kafka.write_timeout %s must be positive", c.Kafka.WriteTimeout))
+	}
+	errs = append(errs, c.Kafka.Provision.validate(), c.Kafka.TLS.validate(), c.Kafka.SASL.validate(), c.Auth.validate())
+	topics := reflect.ValueOf(c.Kafka.Topics)
+	for i := 0; i < topics.NumField(); i++ {
+		if topics.Field(i).String() == "" {
+			errs = append(errs, fmt.Errorf("kafka.topics.%s is empty", yamlName(topics.Type().Field(i))))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Names lists the topic names in declaration order.
+func (t Topics) Names() []string {
+	v := reflect.ValueOf(t)
+	names := make([]string, 0, v.NumField())
+	for i := 0; i < v.NumField(); i++ {
+		names = append(names, v.Field(i).String())
+	}
+	return names
+}
+
+func (p Provision) validate() error {
+	// The audit topic is checked within Timeout even with provisioning off.
+	if p.Timeout <= 0 {
+		return fmt.Errorf("kafka.provision.timeout %s must be positive", p.Timeout)
+	}
+	if !p.Enabled {
+		return nil
+	}
+	var errs []error
+	if p.Partitions < 1 {
+		errs = append(errs, fmt.Errorf("kafka.provision.partitions %d must be at least 1", p.Partitions))
+	}
+	if p.ReplicationFactor < 1 {
+		errs = append(errs, fmt.Errorf("kafka.provision.replication_factor %d must be at least 1", p.ReplicationFactor))
+	}
+	if p.Retention <= 0 {
+		errs = append(errs, fmt.Errorf("kafka.provision.retention %s must be positive", p.Retention))
+	}
+	if p.DLQSuffix == "" {
+		errs = append(errs, errors.New("kafka.provision.dlq_suffix is empty"))
+	}
+	return errors.Join(errs...)
+}
+
+func (a Auth) validate() error {
+	if !a.Enabled {
+		return nil
+	}
+	var errs []error
+	switch a.Algorithm {
+	case "HS256":
+		if a.Secret == "" && a.SecretFile == "" {
+			errs = append(errs, errors.New("auth.algorithm HS256 needs auth.secret or auth.secret_file"))
+		}
+	case "RS256":
+		if a.JWKSFile == "" {
+			errs = append(errs, errors.New("auth.algorithm RS256 needs auth.jwks_file"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("auth.algorithm %q is not HS256 or RS256", a.Algorithm))
+	}
+	if a.RolesClaim == "" {
+		errs = append(errs, errors.New("auth.roles_claim is empty"))
+	}
+	if a.Leeway < 0 {
+		errs = append(errs, fmt.Errorf("auth.leeway %s must not be negative", a.Leeway))
+	}
+	return errors.Join(errs...)
+}
+
+func (t TLS) validate() error {
+	if !t.Enabled {
+		if t.CAFile != "" || t.CertFile != "" || t.KeyFile != "" {
+			return errors.New("kafka.tls files are set but kafka.tls.enabled is false")
+		}
+		return nil
+	}
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return errors.New("kafka.tls.cert_file and kafka.tls.key_file must be set together")
+	}
+	return nil
+}
+
+func (s SASL) validate() error {
+	if s.Mechanism == "" {
+		return nil
+	}
+	known := false
+	for _, mechanism := range SASLMechanisms {
+		known = known || strings.EqualFold(s.Mechanism, mechanism)
+	}
+	if !known {
+		return fmt.Errorf("kafka.sasl.mechanism %q is not one of %s", s.Mechanism, strings.Join(SASLMechanisms, ", "))
+	}
+	if s.Username == "" {
+		return errors.New("kafka.sasl.username is empty")
+	}
+	if s.Password == "" && s.PasswordFile == "" {
+		return errors.New("kafka.sasl needs a password or password_file")
+	}
+	return nil
+}
+
+// Load overlays the YAML file named by CONFIG_FILE, if any, and then the
+// environment onto cfg, a pointer to a struct already holding the defaults,
+// and validates the result.
+func Load(cfg interface{}) error {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("config: Load needs a pointer to a struct, got %T", cfg)
+	}
+
+	if path := os.Getenv(FileEnv); path != "" {
+		if err := loadFile(path, cfg); err != nil {
+			return err
+		}
+	}
+
+	var errs []error
+	walk(v.Elem(), "", func(field reflect.StructField, value reflect.Value, _ string) {
+		name := field.Tag.Get("env")
+		if name == "" {
+			return
+		}
+		raw, ok := os.LookupEnv(name)
+		if old := field.Tag.Get("deprecated"); old != "" && (!ok || raw == "") {
+			if raw, ok = os.LookupEnv(old); ok && raw != "" {
+				slog.Warn("Deprecated environment variable, set "+name+" instead", "variable", old)
+				name = old
+			}
+		}
+		if !ok || raw == "" {
+			return
+		}
+		if err := set(value, raw); err != nil {
+			errs = append(errs, fmt.Errorf("%s=%q: %w", name, raw, err))
+		}
+	})
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	if validator, ok := cfg.(interface{ Validate() error }); ok {
+		if err := validator.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MustLoad is Load for use during startup: it logs the problems and exits.
+func MustLoad(cfg interface{}) {
+	if err := Load(cfg); err != nil {
+		slog.Error("Invalid configuration", "error", err)
+		os.Exit(1)
+	}
+}
+
+func loadFile(path string, cfg interface{}) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+	defer file.Close()
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func set(value reflect.Value, raw string) error {
+	if value.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return err
+		}
+		value.SetInt(int64(d))
+		return nil
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		value.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return err
+		}
+		value.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		value.SetFloat(f)
+	case reflect.Slice:
+		if value.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", value.Type())
+		}
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		value.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", value.Type())
+	}
+	return nil
+}
+
+// walk calls fn for every leaf field of v, flattening embedded structs, with
+// the dotted YAML path of the field.
+func walk(v reflect.Value, prefix string, fn func(reflect.StructField, reflect.Value, string)) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		value := v.Field(i)
+		if field.Anonymous && value.Kind() == reflect.Struct {
+			walk(value, prefix, fn)
+			continue
+		}
+		path := prefix + yamlName(field)
+		if value.Kind() == reflect.Struct && field.Type != durationType {
+			walk(value, path+".", fn)
+			continue
+		}
+		fn(field, value, path)
+	}
+}
+
+func yamlName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	if name == "" || name == "-" {
+		return strings.ToLower(field.Name)
+	}
+	return name
+}
+
+// Effective returns the settings in cfg keyed by their YAML path, with
+// secrets masked.
+func Effective(cfg interface{}) map[string]interface{} {
+	settings := make(map[string]interface{})
+	walk(reflect.Indirect(reflect.ValueOf(cfg)), "", func(field reflect.StructField, value reflect.Value, path string) {
+		switch {
+		case field.Tag.Get("secret") == "true":
+			if !value.IsZero() {
+				settings[path] = "********"
+			} else {
+				settings[path] = ""
+			}
+		case field.Type == durationType:
+			settings[path] = value.Interface().(time.Duration).String()
+		default:
+			settings[path] = value.Interface()
+		}
+	})
+	return settings
+}
+
+// Register adds GET /config, which reports the effective non-secret settings.
+func Register(r gin.IRoutes, cfg interface{}) {
+	r.GET("/config", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{
+			"config_file": os.Getenv(FileEnv),
+			"settings":    Effective(cfg),
+		})
+	})
+}
@@ -0,0 +1,200 @@
+// Package health answers liveness and readiness probes.
+//
+// A service is live while none of its long-running loops has exited; a
+// restart is the only fix for that. It is ready once every warm-up step has
+// finished, every dependency check passes and no loop has been failing for
+// longer than LoopFailureGrace.
+package health
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// How long a single dependency check may take.
+	CheckTimeout = 2 * time.Second
+	// How long a loop may keep failing (e.g. while the broker is down) before
+	// the service stops reporting ready.
+	LoopFailureGrace = 30 * time.Second
+)
+
+// CheckFunc returns nil when a dependency is usable.
+type CheckFunc func(ctx context.Context) error
+
+// Result is the outcome of one check, warm-up step or loop.
+type Result struct {
+	Status string `json:"status"` // ok, failing, pending
+	Error  string `json:"error,omitempty"`
+}
+
+// Report is the body of every health endpoint.
+type Report struct {
+	Status  string            `json:"status"` // healthy, unhealthy
+	Service string            `json:"service"`
+	Uptime  string            `json:"uptime"`
+	Checks  map[string]Result `json:"checks,omitempty"`
+}
+
+type namedCheck struct {
+	name  string
+	check CheckFunc
+}
+
+// Checker holds what a service needs before it can take traffic.
+type Checker struct {
+	service string
+	started time.Time
+
+	mu      sync.RWMutex
+	checks  []namedCheck
+	loops   []*Loop
+	warmups map[string]bool // step name -> finished
+}
+
+func New(service string) *Checker {
+	return &Checker{
+		service: service,
+		started: time.Now(),
+		warmups: make(map[string]bool),
+	}
+}
+
+// AddCheck registers a dependency probed on every readiness request.
+func (c *Checker) AddCheck(name string, check CheckFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, namedCheck{name, check})
+}
+
+// WarmUp registers a startup step. The service is not ready until the
+// returned function has been called.
+func (c *Checker) WarmUp(name string) (done func()) {
+	c.mu.Lock()
+	c.warmups[name] = false
+	c.mu.Unlock()
+
+	return func() {
+		c.mu.Lock()
+		c.warmups[name] = true
+		c.mu.Unlock()
+	}
+}
+
+// Loop registers a long-running loop such as a Kafka consumer.
+func (c *Checker) Loop(name string) *Loop {
+	loop := &Loop{name: name}
+	c.mu.Lock()
+	c.loops = append(c.loops, loop)
+	c.mu.Unlock()
+	return loop
+}
+
+// Live reports whether the process should keep running.
+func (c *Checker) Live() Report {
+	c.mu.RLock()
+	loops := append([]*Loop(nil), c.loops...)
+	c.mu.RUnlock()
+
+	report := c.newReport()
+	for _, loop := range loops {
+		result := loop.result(time.Now())
+		if loop.Exited() {
+			report.Status = "unhealthy"
+		} else {
+			// Failing loops are a readiness problem, not a liveness one.
+			result = Result{Status: "ok"}
+		}
+		report.Checks["loop:"+loop.name] = result
+	}
+	return report
+}
+
+// Ready reports whether the service can take traffic.
+func (c *Checker) Ready(ctx context.Context) Report {
+	c.mu.RLock()
+	checks := append([]namedCheck(nil), c.checks...)
+	loops := append([]*Loop(nil), c.loops...)
+	warmups := make(map[string]bool, len(c.warmups))
+	for name, finished := range c.warmups {
+		warmups[name] = finished
+	}
+	c.mu.RUnlock()
+
+	report := c.newReport()
+	record := func(name string, result Result) {
+		report.Checks[name] = result
+		if result.Status != "ok" {
+			report.Status = "unhealthy"
+		}
+	}
+
+	for name, finished := range warmups {
+		if finished {
+			record("warmup:"+name, Result{Status: "ok"})
+		} else {
+			record("warmup:"+name, Result{Status: "pending"})
+		}
+	}
+
+	now := time.Now()
+	for _, loop := range loops {
+		record("loop:"+loop.name, loop.result(now))
+	}
+
+	// Run the checks concurrently so one slow dependency does not add up.
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check CheckFunc) {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, CheckTimeout)
+			defer cancel()
+			if err := check(checkCtx); err != nil {
+				results[i] = Result{Status: "failing", Error: err.Error()}
+			} else {
+				results[i] = Result{Status: "ok"}
+			}
+		}(i, check.check)
+	}
+	wg.Wait()
+	for i, check := range checks {
+		record(check.name, results[i])
+	}
+	return report
+}
+
+func (c *Checker) newReport() Report {
+	return Report{
+		Status:  "healthy",
+		Service: c.service,
+		Uptime:  time.Since(c.started).Round(time.Second).String(),
+		Checks:  make(map[string]Result),
+	}
+}
+
+// Register adds GET /health/live and GET /health/ready, which answer 503 when
+// unhealthy, and points GET /health at readiness.
+func (c *Checker) Register(r gin.IRoutes) {
+	r.GET("/health/live", func(ctx *gin.Context) {
+		respond(ctx, c.Live())
+	})
+	ready := func(ctx *gin.Context) {
+		respond(ctx, c.Ready(ctx.Request.Context()))
+	}
+	r.GET("/health/ready", ready)
+	r.GET("/health", ready)
+}
+
+func respond(c *gin.Context, report Report) {
+	status := http.StatusOK
+	if report.Status != "healthy" {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
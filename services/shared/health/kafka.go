@@ -0,0 +1,31 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"shared/kafkaconn"
+)
+
+// KafkaCheck reports whether one of the bootstrap brokers of kc accepts
+// connections, including the TLS and SASL handshakes, and answers a metadata
+// request.
+func KafkaCheck(kc *kafkaconn.Conn) CheckFunc {
+	addr := strings.Join(kc.Brokers(), ",")
+	return func(ctx context.Context) error {
+		conn, err := kc.Dial(ctx)
+		if err != nil {
+			return fmt.Errorf("connect to kafka %s: %w", addr, err)
+		}
+		defer conn.Close()
+
+		if deadline, ok := ctx.Deadline(); ok {
+			conn.SetDeadline(deadline)
+		}
+		if _, err := conn.Brokers(); err != nil {
+			return fmt.Errorf("read kafka metadata from %s: %w", addr, err)
+		}
+		return nil
+	}
+}
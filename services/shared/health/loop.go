@@ -0,0 +1,75 @@
+package health
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Loop tracks a long-running goroutine. The goroutine calls Run when it
+// starts, Beat after each successful iteration, Fail when an iteration
+// fails and Exit (usually deferred) when it returns.
+type Loop struct {
+	name string
+
+	mu           sync.Mutex
+	running      bool
+	exited       bool
+	lastBeat     time.Time
+	lastErr      error
+	failingSince time.Time
+}
+
+func (l *Loop) Run() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.running = true
+}
+
+// Beat records a successful iteration and clears any failure.
+func (l *Loop) Beat() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lastBeat = time.Now()
+	l.lastErr = nil
+	l.failingSince = time.Time{}
+}
+
+// Fail records a failed iteration.
+func (l *Loop) Fail(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lastErr = err
+	if l.failingSince.IsZero() {
+		l.failingSince = time.Now()
+	}
+}
+
+func (l *Loop) Exit() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.running = false
+	l.exited = true
+}
+
+func (l *Loop) Exited() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.exited
+}
+
+func (l *Loop) result(now time.Time) Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	switch {
+	case l.exited:
+		return Result{Status: "failing", Error: "loop exited"}
+	case !l.running:
+		return Result{Status: "pending", Error: "loop not started"}
+	case l.lastErr != nil && now.Sub(l.failingSince) > LoopFailureGrace:
+		return Result{Status: "failing", Error: fmt.Sprintf("failing for %s: %v", now.Sub(l.failingSince).Round(time.Second), l.lastErr)}
+	default:
+		return Result{Status: "ok"}
+	}
+}
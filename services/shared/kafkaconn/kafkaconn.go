@@ -0,0 +1,203 @@
+// Package kafkaconn builds the Kafka clients of a service from its
+// configuration, so every producer, consumer and admin request uses the same
+// brokers, TLS and SASL settings.
+package kafkaconn
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+
+	"shared/config"
+)
+
+const dialTimeout = 10 * time.Second
+
+// Conn holds the connection settings shared by all clients of a service.
+type Conn struct {
+	cfg       config.Kafka
+	tls       *tls.Config
+	mechanism sasl.Mechanism
+
+	// Dialer is used by readers and by direct broker connections.
+	Dialer *kafka.Dialer
+	// Transport is shared by writers and admin clients so they reuse
+	// connections.
+	Transport *kafka.Transport
+}
+
+// New resolves the TLS material and SASL credentials in cfg.
+func New(cfg config.Kafka) (*Conn, error) {
+	tlsConfig, err := newTLSConfig(cfg.TLS)
+	if err != nil {
+		return nil, err
+	}
+	mechanism, err := newMechanism(cfg.SASL)
+	if err != nil {
+		return nil, err
+	}
+	c := &Conn{
+		cfg:       cfg,
+		tls:       tlsConfig,
+		mechanism: mechanism,
+		Dialer: &kafka.Dialer{
+			Timeout:       dialTimeout,
+			DualStack:     true,
+			TLS:           tlsConfig,
+			SASLMechanism: mechanism,
+		},
+	}
+	c.Transport = c.newTransport()
+	return c, nil
+}
+
+func (c *Conn) newTransport() *kafka.Transport {
+	return &kafka.Transport{
+		DialTimeout: dialTimeout,
+		TLS:         c.tls,
+		SASL:        c.mechanism,
+	}
+}
+
+// MustNew is New for package initialisation: a certificate or credential
+// that cannot be loaded stops the service.
+func MustNew(cfg config.Kafka) *Conn {
+	conn, err := New(cfg)
+	if err != nil {
+		slog.Error("Invalid Kafka connection settings", "error", err)
+		os.Exit(1)
+	}
+	return conn
+}
+
+// Writer returns a producer for topic.
+func (c *Conn) Writer(topic string) *kafka.Writer {
+	return &kafka.Writer{
+		Addr:         kafka.TCP(c.cfg.Brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.LeastBytes{},
+		WriteTimeout: c.cfg.WriteTimeout,
+		Transport:    c.Transport,
+	}
+}
+
+// Reader returns a consumer for rc with the brokers and dialer filled in.
+func (c *Conn) Reader(rc kafka.ReaderConfig) *kafka.Reader {
+	rc.Brokers = c.cfg.Brokers
+	rc.Dialer = c.Dialer
+	return kafka.NewReader(rc)
+}
+
+// Client returns an admin client whose requests time out after timeout.
+func (c *Conn) Client(timeout time.Duration) *kafka.Client {
+	return &kafka.Client{
+		Addr:      kafka.TCP(c.cfg.Brokers...),
+		Timeout:   timeout,
+		Transport: c.Transport,
+	}
+}
+
+// Dial opens a connection to the first bootstrap broker that accepts one.
+func (c *Conn) Dial(ctx context.Context) (*kafka.Conn, error) {
+	var errs []error
+	for _, broker := range c.cfg.Brokers {
+		conn, err := c.Dialer.DialContext(ctx, "tcp", broker)
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err)
+	}
+	return nil, errors.Join(errs...)
+}
+
+// LookupPartitions reads the partitions of topic, with their leaders, from
+// the first bootstrap broker that answers.
+func (c *Conn) LookupPartitions(ctx context.Context, topic string) ([]kafka.Partition, error) {
+	conn, err := c.Dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return conn.ReadPartitions(topic)
+}
+
+// DialPartition connects to the leader of partition.
+func (c *Conn) DialPartition(ctx context.Context, partition kafka.Partition) (*kafka.Conn, error) {
+	return c.Dialer.DialPartition(ctx, "tcp", "", partition)
+}
+
+// Brokers are the bootstrap broker addresses.
+func (c *Conn) Brokers() []string {
+	return c.cfg.Brokers
+}
+
+func newTLSConfig(cfg config.TLS) (*tls.Config, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read kafka CA: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("kafka CA %s contains no PEM certificates", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load kafka client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+func newMechanism(cfg config.SASL) (sasl.Mechanism, error) {
+	if cfg.Mechanism == "" {
+		return nil, nil
+	}
+	password := cfg.Password
+	if cfg.PasswordFile != "" {
+		raw, err := os.ReadFile(cfg.PasswordFile)
+		if err != nil {
+			return nil, fmt.Errorf("read kafka SASL password: %w", err)
+		}
+		password = strings.TrimRight(string(raw), "\r\n")
+	}
+	if password == "" {
+		return nil, errors.New("kafka SASL password is empty")
+	}
+
+	switch strings.ToUpper(cfg.Mechanism) {
+	case "PLAIN":
+		return plain.Mechanism{Username: cfg.Username, Password: password}, nil
+	case "SCRAM-SHA-256":
+		return scram.Mechanism(scram.SHA256, cfg.Username, password)
+	case "SCRAM-SHA-512":
+		return scram.Mechanism(scram.SHA512, cfg.Username, password)
+	}
+	return nil, fmt.Errorf("unsupported kafka SASL mechanism %q", cfg.Mechanism)
+}
@@ -0,0 +1,351 @@
+package kafkaconn
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	provisionRequestTimeout = 10 * time.Second
+	provisionRetryInterval  = 2 * time.Second
+)
+
+// RequiredTopics are the configured topics followed by their dead letter
+// topics.
+func (c *Conn) RequiredTopics() []string {
+	topics := c.cfg.Topics.Names()
+	for _, topic := range c.cfg.Topics.Names() {
+		topics = append(topics, topic+c.cfg.Provision.DLQSuffix)
+	}
+	return topics
+}
+
+// EnsureTopics checks that every required topic exists with the partitions,
+// replication factor and retention of the provision settings, creating the
+// missing ones if allowed. With provisioning off nothing is checked.
+// Unreachable brokers are retried until the provision timeout; a topic that
+// exists with different settings is an error straight away, since restarting
+// will not fix it.
+func (c *Conn) EnsureTopics(ctx context.Context) error {
+	p := c.cfg.Provision
+	if !p.Enabled {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, p.Timeout)
+	defer cancel()
+
+	// A transport of its own keeps the metadata cached here, taken before
+	// the topics were created, away from the service's writers.
+	transport := c.newTransport()
+	defer transport.CloseIdleConnections()
+	client := &kafka.Client{
+		Addr:      kafka.TCP(c.cfg.Brokers...),
+		Timeout:   provisionRequestTimeout,
+		Transport: transport,
+	}
+	topics := c.RequiredTopics()
+
+	meta, err := c.waitForMetadata(ctx, client, topics)
+	if err != nil {
+		return err
+	}
+	if len(meta.Brokers) < p.ReplicationFactor {
+		return fmt.Errorf("replication factor %d needs at least %d brokers, the cluster has %d",
+			p.ReplicationFactor, p.ReplicationFactor, len(meta.Brokers))
+	}
+
+	missing := missingTopics(meta, topics)
+	if len(missing) > 0 {
+		if !p.Create {
+			return fmt.Errorf("topics %s do not exist and kafka.provision.create is off", strings.Join(missing, ", "))
+		}
+		if err := c.createTopics(ctx, client, missing); err != nil {
+			return err
+		}
+	}
+	// New partitions have no leader for a moment; wait for them so the check
+	// below sees the final layout.
+	if len(missing) > 0 || !leadersElected(meta) {
+		if meta, err = c.waitForLeaders(ctx, client, topics); err != nil {
+			return err
+		}
+	}
+
+	if err := c.checkLayout(meta, topics); err != nil {
+		return err
+	}
+	return c.checkRetention(ctx, client, topics)
+}
+
+// MustEnsureTopics is EnsureTopics for startup: a cluster that cannot provide
+// the topics stops the service.
+func (c *Conn) MustEnsureTopics(ctx context.Context) {
+	if err := c.EnsureTopics(ctx); err != nil {
+		slog.Error("Kafka topics are not usable", "brokers", c.cfg.Brokers, "error", err)
+		os.Exit(1)
+	}
+	if c.cfg.Provision.Enabled {
+		slog.Info("Kafka topics verified", "topics", c.RequiredTopics())
+	}
+}
+
+// CheckAuditTopic checks that the audit topic exists with a single partition,
+// which EnsureTopics has already done when provisioning is on. Unreachable
+// brokers are retried until the provision timeout.
+func (c *Conn) CheckAuditTopic(ctx context.Context) error {
+	if c.cfg.Provision.Enabled {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.Provision.Timeout)
+	defer cancel()
+
+	transport := c.newTransport()
+	defer transport.CloseIdleConnections()
+	client := &kafka.Client{
+		Addr:      kafka.TCP(c.cfg.Brokers...),
+		Timeout:   provisionRequestTimeout,
+		Transport: transport,
+	}
+	meta, err := c.waitForMetadata(ctx, client, []string{c.cfg.Topics.Audit})
+	if err != nil {
+		return err
+	}
+	return c.checkAuditTopic(meta)
+}
+
+// MustCheckAuditTopic is CheckAuditTopic for the audit log's consumer, whose
+// hash chain depends on the topic's order: a topic that does not have it
+// stops the service.
+func (c *Conn) MustCheckAuditTopic(ctx context.Context) {
+	if err := c.CheckAuditTopic(ctx); err != nil {
+		slog.Error("Kafka audit topic is not usable", "topic", c.cfg.Topics.Audit, "error", err)
+		os.Exit(1)
+	}
+}
+
+func (c *Conn) waitForMetadata(ctx context.Context, client *kafka.Client, topics []string) (*kafka.MetadataResponse, error) {
+	for {
+		meta, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: topics})
+		if err == nil {
+			return meta, nil
+		}
+		slog.Warn("Waiting for Kafka", "brokers", c.cfg.Brokers, "error", err)
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("kafka brokers %s unreachable: %w", strings.Join(c.cfg.Brokers, ","), err)
+		case <-time.After(provisionRetryInterval):
+		}
+	}
+}
+
+func (c *Conn) waitForLeaders(ctx context.Context, client *kafka.Client, topics []string) (*kafka.MetadataResponse, error) {
+	for {
+		meta, err := c.waitForMetadata(ctx, client, topics)
+		if err != nil {
+			return nil, err
+		}
+		if leadersElected(meta) {
+			return meta, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("created topics have no partition leaders: %w", ctx.Err())
+		case <-time.After(provisionRetryInterval):
+		}
+	}
+}
+
+func (c *Conn) createTopics(ctx context.Context, client *kafka.Client, topics []string) error {
+	p := c.cfg.Provision
+	req := &kafka.CreateTopicsRequest{}
+	for _, topic := range topics {
+		req.Topics = append(req.Topics, kafka.TopicConfig{
+			Topic:             topic,
+			NumPartitions:     c.partitions(topic),
+			ReplicationFactor: p.ReplicationFactor,
+			ConfigEntries: []kafka.ConfigEntry{
+				{ConfigName: "retention.ms", ConfigValue: c.retentionMs(topic)},
+			},
+		})
+	}
+
+	resp, err := client.CreateTopics(ctx, req)
+	if err != nil {
+		return fmt.Errorf("create topics %s: %w", strings.Join(topics, ", "), err)
+	}
+	var errs []error
+	for _, topic := range topics {
+		// Another service may have created the topic since the metadata
+		// request; its settings are checked like any existing topic.
+		if err := resp.Errors[topic]; err != nil && !errors.Is(err, kafka.TopicAlreadyExists) {
+			errs = append(errs, fmt.Errorf("create topic %s: %w", topic, err))
+			continue
+		}
+		slog.Info("Kafka topic created", "topic", topic,
+			"partitions", c.partitions(topic), "replication_factor", p.ReplicationFactor, "retention_ms", c.retentionMs(topic))
+	}
+	return errors.Join(errs...)
+}
+
+func (c *Conn) checkLayout(meta *kafka.MetadataResponse, topics []string) error {
+	p := c.cfg.Provision
+	byName := make(map[string]kafka.Topic, len(meta.Topics))
+	for _, t := range meta.Topics {
+		byName[t.Name] = t
+	}
+
+	var errs []error
+	for _, name := range topics {
+		t := byName[name]
+		if t.Error != nil {
+			errs = append(errs, fmt.Errorf("topic %s: %w", name, t.Error))
+			continue
+		}
+		if name == c.cfg.Topics.Audit {
+			if err := auditPartitions(t); err != nil {
+				errs = append(errs, err)
+			}
+		} else if len(t.Partitions) < p.Partitions {
+			errs = append(errs, fmt.Errorf("topic %s has %d partitions, want at least %d", name, len(t.Partitions), p.Partitions))
+		}
+		for _, partition := range t.Partitions {
+			if len(partition.Replicas) < p.ReplicationFactor {
+				errs = append(errs, fmt.Errorf("topic %s has replication factor %d, want at least %d", name, len(partition.Replicas), p.ReplicationFactor))
+				break
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// checkAuditTopic checks the audit topic in meta exists with one partition.
+func (c *Conn) checkAuditTopic(meta *kafka.MetadataResponse) error {
+	for _, t := range meta.Topics {
+		if t.Name != c.cfg.Topics.Audit {
+			continue
+		}
+		if t.Error != nil {
+			return fmt.Errorf("topic %s: %w", t.Name, t.Error)
+		}
+		return auditPartitions(t)
+	}
+	return fmt.Errorf("topic %s does not exist", c.cfg.Topics.Audit)
+}
+
+// auditPartitions checks that the audit topic has a single partition. With
+// more, admin actions are not totally ordered and the audit log's hash chain
+// would depend on how the partitions interleave when it is replayed.
+func auditPartitions(t kafka.Topic) error {
+	if len(t.Partitions) != 1 {
+		return fmt.Errorf("topic %s has %d partitions, want 1 so the audit log is replayed in order", t.Name, len(t.Partitions))
+	}
+	return nil
+}
+
+func (c *Conn) checkRetention(ctx context.Context, client *kafka.Client, topics []string) error {
+	req := &kafka.DescribeConfigsRequest{}
+	for _, topic := range topics {
+		req.Resources = append(req.Resources, kafka.DescribeConfigRequestResource{
+			ResourceType: kafka.ResourceTypeTopic,
+			ResourceName: topic,
+			ConfigNames:  []string{"retention.ms"},
+		})
+	}
+
+	resp, err := client.DescribeConfigs(ctx, req)
+	if err != nil {
+		return fmt.Errorf("describe topic configs: %w", err)
+	}
+	var errs []error
+	for _, resource := range resp.Resources {
+		if resource.Error != nil {
+			errs = append(errs, fmt.Errorf("describe topic %s: %w", resource.ResourceName, resource.Error))
+			continue
+		}
+		for _, entry := range resource.ConfigEntries {
+			want := c.retentionMs(resource.ResourceName)
+			if entry.ConfigName == "retention.ms" && !retentionCovers(entry.ConfigValue, want) {
+				errs = append(errs, fmt.Errorf("topic %s has retention.ms %s, want at least %s", resource.ResourceName, entry.ConfigValue, want))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// partitions is the number of partitions topic is created with. The audit
+// topic has one, so every replay rebuilds its hash chain in the same order.
+func (c *Conn) partitions(topic string) int {
+	if topic == c.cfg.Topics.Audit {
+		return 1
+	}
+	return c.cfg.Provision.Partitions
+}
+
+// retentionMs is the retention.ms topic should have.
+func (c *Conn) retentionMs(topic string) string {
+	if topic == c.cfg.Topics.Audit {
+		return "-1"
+	}
+	return strconv.FormatInt(c.cfg.Provision.Retention.Milliseconds(), 10)
+}
+
+// retentionCovers reports whether a topic kept for retention.ms have keeps
+// messages at least as long as want requires. -1 is unlimited.
+func retentionCovers(have, want string) bool {
+	h, err := strconv.ParseInt(have, 10, 64)
+	if err != nil {
+		return false
+	}
+	w, err := strconv.ParseInt(want, 10, 64)
+	if err != nil {
+		return false
+	}
+	switch {
+	case h < 0:
+		return true
+	case w < 0:
+		return false
+	default:
+		return h >= w
+	}
+}
+
+func missingTopics(meta *kafka.MetadataResponse, topics []string) []string {
+	found := make(map[string]bool, len(meta.Topics))
+	for _, t := range meta.Topics {
+		if !errors.Is(t.Error, kafka.UnknownTopicOrPartition) {
+			found[t.Name] = true
+		}
+	}
+	var missing []string
+	for _, topic := range topics {
+		if !found[topic] {
+			missing = append(missing, topic)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+func leadersElected(meta *kafka.MetadataResponse) bool {
+	for _, t := range meta.Topics {
+		if t.Error != nil || len(t.Partitions) == 0 {
+			return false
+		}
+		for _, partition := range t.Partitions {
+			if partition.Error != nil || partition.Leader.Host == "" {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,223 @@
+// Package lag tracks how far a consumer group trails the topics it reads.
+//
+// A Tracker records the last message processed on every partition and, when
+// asked for a report, compares it with the partition end offsets on the
+// broker. Partitions that have not delivered anything since startup fall back
+// to the group's committed offset, or to the start of the partition for
+// groups that never commit.
+package lag
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/segmentio/kafka-go"
+
+	"shared/kafkaconn"
+)
+
+const (
+	// Reports are cached for this long so frequent polling does not hit the
+	// broker on every request.
+	refreshInterval = 5 * time.Second
+	requestTimeout  = 5 * time.Second
+)
+
+// PartitionLag is the state of one partition.
+type PartitionLag struct {
+	Topic           string     `json:"topic"`
+	Partition       int        `json:"partition"`
+	EndOffset       int64      `json:"end_offset"`
+	CommittedOffset int64      `json:"committed_offset"` // -1 if the group has not committed
+	LastOffset      int64      `json:"last_offset"`      // last processed, -1 if none since startup
+	LastProcessedAt *time.Time `json:"last_processed_at,omitempty"`
+	Lag             int64      `json:"lag"`
+}
+
+// Report is the body of GET /consumer/lag.
+type Report struct {
+	Service    string         `json:"service"`
+	GroupID    string         `json:"group_id"`
+	Topics     []string       `json:"topics"`
+	TotalLag   int64          `json:"total_lag"`
+	Partitions []PartitionLag `json:"partitions"`
+	CheckedAt  time.Time      `json:"checked_at"`
+	Error      string         `json:"error,omitempty"`
+}
+
+type partitionKey struct {
+	topic     string
+	partition int
+}
+
+type processed struct {
+	offset int64
+	at     time.Time
+}
+
+// Tracker follows one consumer group.
+type Tracker struct {
+	service string
+	groupID string
+	topics  []string
+	client  *kafka.Client
+
+	mu        sync.Mutex
+	processed map[partitionKey]processed
+	report    *Report
+}
+
+func NewTracker(service, groupID string, conn *kafkaconn.Conn, topics ...string) *Tracker {
+	return &Tracker{
+		service:   service,
+		groupID:   groupID,
+		topics:    topics,
+		client:    conn.Client(requestTimeout),
+		processed: make(map[partitionKey]processed),
+	}
+}
+
+// Processed records that msg has been handled.
+func (t *Tracker) Processed(msg kafka.Message) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.processed[partitionKey{msg.Topic, msg.Partition}] = processed{offset: msg.Offset, at: time.Now()}
+}
+
+// Report returns the lag of every partition, refreshing the end offsets if
+// the cached report is older than refreshInterval.
+func (t *Tracker) Report(ctx context.Context) Report {
+	t.mu.Lock()
+	if t.report != nil && time.Since(t.report.CheckedAt) < refreshInterval {
+		report := *t.report
+		t.mu.Unlock()
+		return report
+	}
+	t.mu.Unlock()
+
+	report := t.build(ctx)
+
+	t.mu.Lock()
+	t.report = &report
+	t.mu.Unlock()
+	return report
+}
+
+func (t *Tracker) build(ctx context.Context) Report {
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+
+	report := Report{
+		Service:    t.service,
+		GroupID:    t.groupID,
+		Topics:     t.topics,
+		Partitions: []PartitionLag{},
+		CheckedAt:  time.Now(),
+	}
+
+	metadata, err := t.client.Metadata(ctx, &kafka.MetadataRequest{Topics: t.topics})
+	if err != nil {
+		report.Error = fmt.Sprintf("read metadata: %v", err)
+		return report
+	}
+	requests := make(map[string][]kafka.OffsetRequest)
+	partitions := make(map[string][]int)
+	for _, topic := range metadata.Topics {
+		if topic.Error != nil {
+			continue
+		}
+		for _, partition := range topic.Partitions {
+			requests[topic.Name] = append(requests[topic.Name],
+				kafka.FirstOffsetOf(partition.ID), kafka.LastOffsetOf(partition.ID))
+			partitions[topic.Name] = append(partitions[topic.Name], partition.ID)
+		}
+	}
+	if len(requests) == 0 {
+		return report
+	}
+
+	offsets, err := t.client.ListOffsets(ctx, &kafka.ListOffsetsRequest{Topics: requests})
+	if err != nil {
+		report.Error = fmt.Sprintf("list offsets: %v", err)
+		return report
+	}
+
+	committed := make(map[partitionKey]int64)
+	fetched, err := t.client.OffsetFetch(ctx, &kafka.OffsetFetchRequest{GroupID: t.groupID, Topics: partitions})
+	if err == nil && fetched.Error != nil {
+		err = fetched.Error
+	}
+	if err != nil {
+		// Lag is still meaningful for processed partitions.
+		report.Error = fmt.Sprintf("fetch committed offsets: %v", err)
+	} else {
+		for topic, partitions := range fetched.Topics {
+			for _, partition := range partitions {
+				if partition.Error == nil {
+					committed[partitionKey{topic, partition.Partition}] = partition.CommittedOffset
+				}
+			}
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for topic, partitionOffsets := range offsets.Topics {
+		for _, offset := range partitionOffsets {
+			if offset.Error != nil {
+				continue
+			}
+			key := partitionKey{topic, offset.Partition}
+			state := PartitionLag{
+				Topic:           topic,
+				Partition:       offset.Partition,
+				EndOffset:       offset.LastOffset,
+				CommittedOffset: -1,
+				LastOffset:      -1,
+			}
+			if c, ok := committed[key]; ok && c >= 0 {
+				state.CommittedOffset = c
+			}
+
+			// The next offset the group will read.
+			next := offset.FirstOffset
+			if state.CommittedOffset > next {
+				next = state.CommittedOffset
+			}
+			if p, ok := t.processed[key]; ok {
+				at := p.at
+				state.LastOffset = p.offset
+				state.LastProcessedAt = &at
+				if p.offset+1 > next {
+					next = p.offset + 1
+				}
+			}
+			if lag := state.EndOffset - next; lag > 0 {
+				state.Lag = lag
+			}
+			report.TotalLag += state.Lag
+			report.Partitions = append(report.Partitions, state)
+		}
+	}
+	sort.Slice(report.Partitions, func(i, j int) bool {
+		a, b := report.Partitions[i], report.Partitions[j]
+		if a.Topic != b.Topic {
+			return a.Topic < b.Topic
+		}
+		return a.Partition < b.Partition
+	})
+	return report
+}
+
+// Register adds GET /consumer/lag.
+func (t *Tracker) Register(r gin.IRoutes) {
+	r.GET("/consumer/lag", func(c *gin.Context) {
+		c.JSON(http.StatusOK, t.Report(c.Request.Context()))
+	})
+}
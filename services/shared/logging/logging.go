@@ -0,0 +1,130 @@
+// Package logging is the structured JSON logger shared by every service.
+//
+// Init makes it the slog default and routes the standard log package through
+// it. Every line carries the service name; lines logged with a context also
+// carry the order ID, event ID and trace/span IDs found in it, so one order can
+// be followed across services by filtering on order_id or trace_id.
+//
+// The level comes from LOG_LEVEL: debug, info (default), warn or error.
+package logging
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type contextKey int
+
+const (
+	orderIDKey contextKey = iota
+	eventIDKey
+)
+
+// Init installs the JSON logger for service.
+func Init(service string) {
+	handler := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: level()})
+	slog.SetDefault(slog.New(contextHandler{handler}).With("service", service))
+}
+
+func level() slog.Level {
+	switch strings.ToLower(os.Getenv("LOG_LEVEL")) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// WithOrderID returns ctx tagged with the order its log lines concern.
+func WithOrderID(ctx context.Context, orderID string) context.Context {
+	if orderID == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, orderIDKey, orderID)
+}
+
+// WithEventID returns ctx tagged with the event being handled.
+func WithEventID(ctx context.Context, eventID string) context.Context {
+	return context.WithValue(ctx, eventIDKey, eventID)
+}
+
+// EventID identifies an event by its encoded payload, so the producer and
+// every consumer of the same message log the same ID.
+func EventID(value []byte) string {
+	sum := sha256.Sum256(value)
+	return hex.EncodeToString(sum[:16])
+}
+
+// contextHandler adds the correlation IDs carried by the context.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if ctx != nil {
+		if orderID, ok := ctx.Value(orderIDKey).(string); ok {
+			record.AddAttrs(slog.String("order_id", orderID))
+		}
+		if eventID, ok := ctx.Value(eventIDKey).(string); ok {
+			record.AddAttrs(slog.String("event_id", eventID))
+		}
+		if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+			record.AddAttrs(
+				slog.String("trace_id", spanContext.TraceID().String()),
+				slog.String("span_id", spanContext.SpanID().String()))
+		}
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// Middleware logs one line per request in place of gin's text logger. Server
+// errors are logged at error level, client errors at warn.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= 500:
+			level = slog.LevelError
+		case status >= 400:
+			level = slog.LevelWarn
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.String("route", c.FullPath()),
+			slog.Int("status", status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("client_ip", c.ClientIP()),
+			slog.Int("bytes", c.Writer.Size()),
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("error", c.Errors.String()))
+		}
+		slog.LogAttrs(c.Request.Context(), level, "request", attrs...)
+	}
+}
@@ -0,0 +1,138 @@
+// Package metrics is the Prometheus instrumentation shared by every service.
+//
+// Every series carries a service label. HTTP and Kafka collectors are
+// registered by Init; the domain collectors are registered only by the
+// services that record them, so a service does not export zero-valued series
+// for work it never does.
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var registry = prometheus.NewRegistry()
+
+// HTTP and Kafka
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests handled, by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency, by method, route and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	kafkaPublished = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kafka_messages_published_total",
+		Help: "Kafka messages published, by topic and result (ok, error).",
+	}, []string{"topic", "result"})
+
+	kafkaPublishDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "kafka_publish_duration_seconds",
+		Help:    "Time to write a message to Kafka, by topic.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"topic"})
+
+	kafkaConsumed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kafka_messages_consumed_total",
+		Help: "Kafka messages consumed, by topic and result (ok, error).",
+	}, []string{"topic", "result"})
+
+	kafkaConsumeDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "kafka_consume_duration_seconds",
+		Help:    "Time to handle a consumed message, by topic.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"topic"})
+)
+
+// Domain collectors. Pass the ones a service records to Init.
+var (
+	OrdersCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "orders_created_total",
+		Help: "Orders accepted and published.",
+	})
+
+	ReservationsRejected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "inventory_reservations_rejected_total",
+		Help: "Stock reservations rejected, by reason.",
+	}, []string{"reason"})
+
+	PaymentsFailed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "payments_failed_total",
+		Help: "Failed payments, by reason.",
+	}, []string{"reason"})
+
+	ShipmentsCreated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "shipments_created_total",
+		Help: "Shipments created, by carrier.",
+	}, []string{"carrier"})
+
+	StockLevel = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "inventory_stock_level",
+		Help: "Units in stock, by product.",
+	}, []string{"product_id"})
+)
+
+// Init registers the HTTP, Kafka and runtime collectors plus the given
+// domain collectors, all labelled with service.
+func Init(service string, domain ...prometheus.Collector) {
+	labelled := prometheus.WrapRegistererWith(prometheus.Labels{"service": service}, registry)
+	labelled.MustRegister(
+		httpRequests, httpDuration,
+		kafkaPublished, kafkaPublishDuration,
+		kafkaConsumed, kafkaConsumeDuration,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	labelled.MustRegister(domain...)
+}
+
+// Middleware records every request by its route pattern, so paths with IDs
+// do not create a series each.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		httpRequests.WithLabelValues(c.Request.Method, route, status).Inc()
+		httpDuration.WithLabelValues(c.Request.Method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Register adds GET /metrics.
+func Register(r gin.IRoutes) {
+	r.GET("/metrics", gin.WrapH(promhttp.HandlerFor(registry, promhttp.HandlerOpts{})))
+}
+
+// ObservePublish records a Kafka write that started at start.
+func ObservePublish(topic string, start time.Time, err error) {
+	kafkaPublished.WithLabelValues(topic, result(err)).Inc()
+	kafkaPublishDuration.WithLabelValues(topic).Observe(time.Since(start).Seconds())
+}
+
+// ObserveConsume records handling a consumed message that started at start.
+func ObserveConsume(topic string, start time.Time, err error) {
+	kafkaConsumed.WithLabelValues(topic, result(err)).Inc()
+	kafkaConsumeDuration.WithLabelValues(topic).Observe(time.Since(start).Seconds())
+}
+
+func result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
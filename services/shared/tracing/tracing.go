@@ -0,0 +1,138 @@
+// Package tracing sets up OpenTelemetry for a service and carries W3C trace
+// context between services in Kafka message headers, so a single trace
+// follows an order from the HTTP request that created it through every
+// consumer it reaches.
+//
+// Spans are exported over OTLP/HTTP when OTEL_EXPORTER_OTLP_ENDPOINT (or
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT) is set, e.g. http://jaeger:4318.
+// Without it spans are still created and propagated, only not exported.
+package tracing
+
+import (
+	"context"
+	"log/slog"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	"github.com/segmentio/kafka-go"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentation = "shared/tracing"
+
+var serviceName = "unknown"
+
+// Init installs the global tracer provider and W3C propagator for service.
+func Init(service string) {
+	serviceName = service
+
+	options := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(service))),
+	}
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != "" {
+		exporter, err := otlptracehttp.New(context.Background())
+		if err != nil {
+			slog.Warn("OTLP exporter unavailable, spans will not be exported", "error", err)
+		} else {
+			options = append(options, sdktrace.WithBatcher(exporter))
+		}
+	}
+
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(options...))
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{}))
+}
+
+// Middleware starts a server span for every request, continuing any trace
+// context sent by the caller. Handlers reach it via c.Request.Context().
+func Middleware() gin.HandlerFunc {
+	return otelgin.Middleware(serviceName)
+}
+
+// StartPublish starts a producer span for a message about to be written to
+// topic and injects its context into the message headers. Finish it with End
+// once the write returns.
+func StartPublish(ctx context.Context, topic string, msg *kafka.Message) (context.Context, trace.Span) {
+	ctx, span := otel.Tracer(instrumentation).Start(ctx, topic+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystem("kafka"),
+			semconv.MessagingDestinationName(topic),
+			semconv.MessagingOperationPublish,
+			semconv.MessagingKafkaMessageKey(string(msg.Key)),
+		))
+	otel.GetTextMapPropagator().Inject(ctx, headerCarrier{msg})
+	return ctx, span
+}
+
+// StartConsume starts a consumer span for msg as a child of the span that
+// published it. The returned context should be passed on to anything the
+// message causes to be published.
+func StartConsume(msg kafka.Message) (context.Context, trace.Span) {
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), headerCarrier{&msg})
+	return otel.Tracer(instrumentation).Start(ctx, msg.Topic+" process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			semconv.MessagingSystem("kafka"),
+			semconv.MessagingDestinationName(msg.Topic),
+			semconv.MessagingOperationProcess,
+			semconv.MessagingKafkaDestinationPartition(msg.Partition),
+			semconv.MessagingKafkaMessageOffset(int(msg.Offset)),
+			semconv.MessagingKafkaMessageKey(string(msg.Key)),
+		))
+}
+
+// End records err, if any, on span and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// OrderID tags the span in ctx with the order it concerns.
+func OrderID(ctx context.Context, orderID string) {
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("order.id", orderID))
+}
+
+// headerCarrier adapts Kafka message headers to propagation.TextMapCarrier.
+type headerCarrier struct {
+	msg *kafka.Message
+}
+
+func (c headerCarrier) Get(key string) string {
+	for _, header := range c.msg.Headers {
+		if header.Key == key {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+func (c headerCarrier) Set(key, value string) {
+	for i, header := range c.msg.Headers {
+		if header.Key == key {
+			c.msg.Headers[i].Value = []byte(value)
+			return
+		}
+	}
+	c.msg.Headers = append(c.msg.Headers, kafka.Header{Key: key, Value: []byte(value)})
+}
+
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(c.msg.Headers))
+	for _, header := range c.msg.Headers {
+		keys = append(keys, header.Key)
+	}
+	return keys
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"shared/auth"
+	"shared/config"
+	"shared/kafkaconn"
+	"shared/logging"
+)
+
+type Config struct {
+	config.Common `yaml:",inline"`
+
+	ProcessingDelay time.Duration `yaml:"processing_delay" env:"SHIPPING_PROCESSING_DELAY"`
+}
+
+func (c Config) Validate() error {
+	errs := []error{c.Common.Validate()}
+	if c.ProcessingDelay < 0 {
+		errs = append(errs, fmt.Errorf("processing_delay %s is negative", c.ProcessingDelay))
+	}
+	return errors.Join(errs...)
+}
+
+// cfg is initialised before any other package state that reads it, so an
+// invalid configuration stops the service before it touches Kafka.
+var cfg = loadConfig()
+
+// kafkaConn carries the broker, TLS and SASL settings to every Kafka client.
+var kafkaConn = kafkaconn.MustNew(cfg.Kafka)
+
+// authn validates the bearer tokens of API requests.
+var authn = auth.MustNew(cfg.Auth)
+
+func loadConfig() *Config {
+	logging.Init("shipping-service")
+
+	c := &Config{
+		Common:          config.Defaults("shipping-service", 8086),
+		ProcessingDelay: 200 * time.Millisecond,
+	}
+	config.MustLoad(c)
+	return c
+}
@@ -3,15 +3,21 @@ package main
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"log/slog"
 	"net/http"
-	"os"
 	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/segmentio/kafka-go"
+
+	"shared/config"
+	"shared/health"
+	"shared/lag"
+	"shared/logging"
+	"shared/metrics"
+	"shared/tracing"
 )
 
 type PaymentEvent struct {
@@ -62,19 +68,14 @@ func (sl *ShipmentLog) GetShipments() []ShippingEvent {
 
 var shipmentLog = NewShipmentLog()
 
-func getKafkaBroker() string {
-	if broker := os.Getenv("KAFKA_BROKER"); broker != "" {
-		return broker
-	}
-	return "localhost:9092"
-}
+// healthChecker backs /health, /health/live and /health/ready.
+var healthChecker = health.New("shipping-service")
 
-func publishShippingEvent(event ShippingEvent) error {
-	writer := &kafka.Writer{
-		Addr:     kafka.TCP(getKafkaBroker()),
-		Topic:    "shipping",
-		Balancer: &kafka.LeastBytes{},
-	}
+// lagTracker backs /consumer/lag.
+var lagTracker = lag.NewTracker("shipping-service", cfg.Kafka.GroupID, kafkaConn, cfg.Kafka.Topics.Payment)
+
+func publishShippingEvent(ctx context.Context, event ShippingEvent) error {
+	writer := kafkaConn.Writer(cfg.Kafka.Topics.Shipping)
 	defer writer.Close()
 
 	eventBytes, err := json.Marshal(event)
@@ -82,16 +83,25 @@ func publishShippingEvent(event ShippingEvent) error {
 		return err
 	}
 
-	return writer.WriteMessages(context.Background(),
-		kafka.Message{
-			Key:   []byte(event.OrderID),
-			Value: eventBytes,
-		},
-	)
+	msg := kafka.Message{
+		Key:   []byte(event.OrderID),
+		Value: eventBytes,
+	}
+
+	ctx, span := tracing.StartPublish(ctx, cfg.Kafka.Topics.Shipping, &msg)
+	ctx = logging.WithEventID(ctx, logging.EventID(eventBytes))
+	start := time.Now()
+	err = writer.WriteMessages(ctx, msg)
+	metrics.ObservePublish(cfg.Kafka.Topics.Shipping, start, err)
+	tracing.End(span, err)
+	if err == nil {
+		slog.DebugContext(ctx, "Event published", "topic", cfg.Kafka.Topics.Shipping)
+	}
+	return err
 }
 
-func processShipment(orderID, productID string, quantity int) ShippingEvent {
-	time.Sleep(200 * time.Millisecond)
+func processShipment(ctx context.Context, orderID, productID string, quantity int) ShippingEvent {
+	time.Sleep(cfg.ProcessingDelay)
 
 	carriers := []string{"FedEx", "UPS", "DHL", "USPS"}
 	carrier := carriers[len(orderID)%len(carriers)]
@@ -114,48 +124,64 @@ func processShipment(orderID, productID string, quantity int) ShippingEvent {
 		ShippedAt:      time.Now(),
 	}
 
-	log.Printf("Order shipped: %s via %s, tracking: %s", orderID, carrier, trackingNumber)
+	slog.InfoContext(ctx, "Order shipped", "carrier", carrier, "tracking_number", trackingNumber)
+	metrics.ShipmentsCreated.WithLabelValues(carrier).Inc()
 	return event
 }
 
-func processPaymentEvent(event PaymentEvent) {
+func processPaymentEvent(ctx context.Context, event PaymentEvent) {
 	if event.EventType != "PaymentCompleted" {
-		log.Printf("Ignoring payment event: %s for order: %s", event.EventType, event.OrderID)
+		slog.DebugContext(ctx, "Ignoring payment event", "event_type", event.EventType)
 		return
 	}
 
-	log.Printf("Processing shipment for order: %s", event.OrderID)
+	slog.InfoContext(ctx, "Processing shipment")
 
-	shippingEvent := processShipment(event.OrderID, event.ProductID, event.Quantity)
+	shippingEvent := processShipment(ctx, event.OrderID, event.ProductID, event.Quantity)
 	shipmentLog.AddShipment(shippingEvent)
 
-	if err := publishShippingEvent(shippingEvent); err != nil {
-		log.Printf("Failed to publish shipping event: %v", err)
+	if err := publishShippingEvent(ctx, shippingEvent); err != nil {
+		slog.ErrorContext(ctx, "Failed to publish shipping event", "error", err)
 	}
 }
 
 func consumePaymentEvents() {
-	reader := kafka.NewReader(kafka.ReaderConfig{
-		Brokers: []string{getKafkaBroker()},
-		Topic:   "payment",
-		GroupID: "shipping-service",
+	loop := healthChecker.Loop("consume-payment")
+	loop.Run()
+	defer loop.Exit()
+
+	reader := kafkaConn.Reader(kafka.ReaderConfig{
+		Topic:   cfg.Kafka.Topics.Payment,
+		GroupID: cfg.Kafka.GroupID,
 	})
 	defer reader.Close()
 
 	for {
 		msg, err := reader.ReadMessage(context.Background())
 		if err != nil {
-			log.Printf("Error reading message: %v", err)
+			slog.Error("Error reading message", "topic", cfg.Kafka.Topics.Payment, "error", err)
+			loop.Fail(err)
 			continue
 		}
+		loop.Beat()
+		ctx, span := tracing.StartConsume(msg)
+		ctx = logging.WithEventID(ctx, logging.EventID(msg.Value))
+		start := time.Now()
 
 		var event PaymentEvent
 		if err := json.Unmarshal(msg.Value, &event); err != nil {
-			log.Printf("Error unmarshaling message: %v", err)
+			slog.ErrorContext(ctx, "Error unmarshaling message", "topic", msg.Topic, "error", err)
+			metrics.ObserveConsume(msg.Topic, start, err)
+			tracing.End(span, err)
 			continue
 		}
 
-		processPaymentEvent(event)
+		ctx = logging.WithOrderID(ctx, event.OrderID)
+		tracing.OrderID(ctx, event.OrderID)
+		processPaymentEvent(ctx, event)
+		metrics.ObserveConsume(msg.Topic, start, nil)
+		tracing.End(span, nil)
+		lagTracker.Processed(msg)
 	}
 }
 
@@ -179,18 +205,29 @@ func trackShipment(c *gin.Context) {
 	c.JSON(http.StatusNotFound, gin.H{"error": "Tracking number not found"})
 }
 
-func healthCheck(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"status": "healthy", "service": "shipping-service"})
-}
-
 func main() {
+	metrics.Init("shipping-service", metrics.ShipmentsCreated)
+	tracing.Init("shipping-service")
+	kafkaConn.MustEnsureTopics(context.Background())
+
+	healthChecker.AddCheck("kafka", health.KafkaCheck(kafkaConn))
+
 	go consumePaymentEvents()
 
-	r := gin.Default()
+	r := gin.New()
+	r.Use(gin.Recovery())
+	r.Use(tracing.Middleware())
+	r.Use(logging.Middleware())
+	r.Use(metrics.Middleware())
+	r.Use(authn.Middleware())
+	r.Use(authn.Authorize("shipping-service"))
 	r.GET("/shipments", getShipments)
 	r.GET("/track/:tracking", trackShipment)
-	r.GET("/health", healthCheck)
+	healthChecker.Register(r)
+	metrics.Register(r)
+	config.Register(r, cfg)
+	lagTracker.Register(r)
 
-	log.Printf("Shipping Service starting on port :8086")
-	r.Run(":8086")
+	slog.Info("Shipping Service starting", "addr", cfg.Addr())
+	r.Run(cfg.Addr())
 }
\ No newline at end of file
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"shared/auth"
+	"shared/config"
+	"shared/kafkaconn"
+	"shared/logging"
+)
+
+type Config struct {
+	config.Common `yaml:",inline"`
+
+	// DatabaseURL selects the Postgres order store; empty keeps orders in
+	// memory.
+	DatabaseURL string   `yaml:"database_url" env:"DATABASE_URL" secret:"true"`
+	Features    Features `yaml:"features"`
+	Rebuild     Rebuild  `yaml:"rebuild"`
+}
+
+type Features struct {
+	// RebuildOnStart replays every topic from the earliest offset at startup
+	// even with a persistent store. The -rebuild flag also enables it.
+	RebuildOnStart bool `yaml:"rebuild_on_start" env:"FEATURE_REBUILD_ON_START"`
+}
+
+type Rebuild struct {
+	// IdleTimeout is how long a rebuild waits for the next message of a
+	// partition it is replaying before it fails, so an offset that is never
+	// delivered cannot stall it forever.
+	IdleTimeout time.Duration `yaml:"idle_timeout" env:"REBUILD_IDLE_TIMEOUT"`
+}
+
+func (c Config) Validate() error {
+	if err := c.Common.Validate(); err != nil {
+		return err
+	}
+	if c.Rebuild.IdleTimeout <= 0 {
+		return fmt.Errorf("rebuild.idle_timeout %s must be positive", c.Rebuild.IdleTimeout)
+	}
+	return nil
+}
+
+// cfg is initialised before any other package state that reads it, so an
+// invalid configuration stops the service before it touches Kafka.
+var cfg = loadConfig()
+
+// kafkaConn carries the broker, TLS and SASL settings to every Kafka client.
+var kafkaConn = kafkaconn.MustNew(cfg.Kafka)
+
+// authn validates the bearer tokens of API requests.
+var authn = auth.MustNew(cfg.Auth)
+
+func loadConfig() *Config {
+	logging.Init("status-service")
+
+	c := &Config{
+		Common:  config.Defaults("status-service", 8087),
+		Rebuild: Rebuild{IdleTimeout: 2 * time.Minute},
+	}
+	config.MustLoad(c)
+	return c
+}
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// Time allowed to write a message to the peer.
+	writeWait = 10 * time.Second
+	// Time allowed to read the next pong message from the peer.
+	pongWait = 60 * time.Second
+	// Send pings to the peer with this period. Must be less than pongWait.
+	pingPeriod = (pongWait * 9) / 10
+	// Maximum message size allowed from the peer.
+	maxMessageSize = 4096
+	// Messages queued per connection before it is treated as a slow client
+	// and evicted.
+	sendQueueSize = 64
+	// Maximum subscriptions a single feed connection may hold.
+	maxSubscriptions = 32
+)
+
+// Subscription selects which order updates a feed connection receives. Set
+// filters are combined with AND; All must be set explicitly to receive every
+// order.
+type Subscription struct {
+	ID         string `json:"id"`
+	All        bool   `json:"all,omitempty"`
+	OrderID    string `json:"order_id,omitempty"`
+	Status     string `json:"status,omitempty"`
+	ProductID  string `json:"product_id,omitempty"`
+	CustomerID string `json:"customer_id,omitempty"`
+}
+
+func (s Subscription) validate() error {
+	if s.ID == "" {
+		return errors.New("subscription id is required")
+	}
+	if !s.All && s.OrderID == "" && s.Status == "" && s.ProductID == "" && s.CustomerID == "" {
+		return errors.New(`subscription needs at least one filter or "all": true`)
+	}
+	return nil
+}
+
+// Matches reports whether order passes every filter set on the subscription.
+func (s Subscription) Matches(order *OrderStatus) bool {
+	if s.OrderID != "" && s.OrderID != order.OrderID {
+		return false
+	}
+	if s.Status != "" && s.Status != order.Status {
+		return false
+	}
+	if s.ProductID != "" && s.ProductID != order.ProductID {
+		return false
+	}
+	if s.CustomerID != "" && s.CustomerID != order.CustomerID {
+		return false
+	}
+	return true
+}
+
+// FeedRequest is a message sent by a feed client.
+type FeedRequest struct {
+	Action       string       `json:"action"` // subscribe, unsubscribe, list
+	Subscription Subscription `json:"subscription"`
+}
+
+// FeedMessage is a message sent to a feed client.
+type FeedMessage struct {
+	Type          string         `json:"type"` // order_update, order_deleted, resync, subscribed, unsubscribed, subscriptions, error
+	Subscriptions []string       `json:"subscriptions,omitempty"`
+	Subscription  *Subscription  `json:"subscription,omitempty"`
+	Active        []Subscription `json:"active,omitempty"`
+	OrderID       string         `json:"order_id,omitempty"`
+	Order         *OrderStatus   `json:"order,omitempty"`
+	Error         string         `json:"error,omitempty"`
+}
+
+// Client is a single WebSocket connection. All writes go through send and are
+// performed by writePump, so a slow peer never blocks the broadcaster.
+//
+// Order clients (connected via /ws/:orderId) follow one order and receive the
+// bare order JSON. Feed clients (connected via /ws) manage their own
+// subscriptions and receive FeedMessage envelopes.
+type Client struct {
+	hub     *Hub
+	conn    *websocket.Conn
+	orderID string
+	send    chan []byte
+	done    chan struct{}
+
+	subMu         sync.RWMutex
+	subscriptions map[string]Subscription
+
+	// versions is the version of each order last queued to the client; see
+	// sendUpdate.
+	versionMu sync.Mutex
+	versions  map[string]int
+
+	closeOnce sync.Once
+}
+
+// orderVersion orders the states of one order: every applied event adds one
+// to the history, and the store applies an order's events one at a time.
+func orderVersion(order *OrderStatus) int {
+	return len(order.Events)
+}
+
+// Hub is the registry of WebSocket connections. It is independent of the order
+// store so fan-out never holds store locks.
+type Hub struct {
+	mu      sync.RWMutex
+	clients map[*Client]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		clients: make(map[*Client]struct{}),
+	}
+}
+
+// Register adds a connection and starts its writer goroutine. orderID is empty
+// for feed clients. The caller runs ReadPump; the connection is unregistered
+// when either side stops.
+func (h *Hub) Register(conn *websocket.Conn, orderID string) *Client {
+	client := &Client{
+		hub:           h,
+		conn:          conn,
+		orderID:       orderID,
+		send:          make(chan []byte, sendQueueSize),
+		done:          make(chan struct{}),
+		subscriptions: make(map[string]Subscription),
+		versions:      make(map[string]int),
+	}
+
+	h.mu.Lock()
+	h.clients[client] = struct{}{}
+	h.mu.Unlock()
+
+	go client.writePump()
+	return client
+}
+
+func (h *Hub) unregister(client *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.clients, client)
+}
+
+func (h *Hub) snapshot() []*Client {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	clients := make([]*Client, 0, len(h.clients))
+	for client := range h.clients {
+		clients = append(clients, client)
+	}
+	return clients
+}
+
+// Broadcast queues an order update for every client following it, filtering
+// feed subscriptions server-side. Clients whose queue is full are evicted
+// rather than waited on.
+func (h *Hub) Broadcast(order *OrderStatus) {
+	// A payload that cannot be marshaled is skipped for order clients only,
+	// so feed clients are still sent theirs.
+	raw, err := json.Marshal(order)
+	if err != nil {
+		slog.Error("Error marshaling order status", "order_id", order.OrderID, "error", err)
+	}
+	for _, client := range h.snapshot() {
+		if client.orderID != "" {
+			if client.orderID == order.OrderID && err == nil {
+				client.sendUpdate(order, raw)
+			}
+			continue
+		}
+
+		if matched := client.matching(order); len(matched) > 0 {
+			data, err := json.Marshal(FeedMessage{Type: "order_update", Subscriptions: matched, Order: order})
+			if err != nil {
+				slog.Error("Error marshaling feed message", "order_id", order.OrderID, "error", err)
+				continue
+			}
+			client.sendUpdate(order, data)
+		}
+	}
+}
+
+// OrderDeleted closes order clients following orderID and tells feed clients
+// that could have seen the order that it is gone.
+func (h *Hub) OrderDeleted(orderID string) {
+	for _, client := range h.snapshot() {
+		if client.orderID == orderID {
+			client.Close()
+		} else if client.orderID == "" && client.hasSubscriptions() {
+			client.forget(orderID)
+			client.SendJSON(FeedMessage{Type: "order_deleted", OrderID: orderID})
+		}
+	}
+}
+
+// Resync tells feed clients the whole projection was replaced, so any state
+// they hold should be refetched.
+func (h *Hub) Resync() {
+	for _, client := range h.snapshot() {
+		if client.orderID == "" {
+			client.SendJSON(FeedMessage{Type: "resync"})
+		}
+	}
+}
+
+// ResetVersions forgets the order versions sent to every client, so the
+// states of a rebuilt projection are sent even where a rebuild from a
+// shortened history has made them look older.
+func (h *Hub) ResetVersions() {
+	for _, client := range h.snapshot() {
+		client.versionMu.Lock()
+		client.versions = make(map[string]int)
+		client.versionMu.Unlock()
+	}
+}
+
+// OrderIDs returns the orders that order clients are currently following.
+func (h *Hub) OrderIDs() []string {
+	seen := make(map[string]bool)
+	ids := make([]string, 0)
+	for _, client := range h.snapshot() {
+		if client.orderID != "" && !seen[client.orderID] {
+			seen[client.orderID] = true
+			ids = append(ids, client.orderID)
+		}
+	}
+	return ids
+}
+
+// matching returns the IDs of the client's subscriptions that accept order.
+func (c *Client) matching(order *OrderStatus) []string {
+	c.subMu.RLock()
+	defer c.subMu.RUnlock()
+
+	var matched []string
+	for id, sub := range c.subscriptions {
+		if sub.Matches(order) {
+			matched = append(matched, id)
+		}
+	}
+	return matched
+}
+
+func (c *Client) hasSubscriptions() bool {
+	c.subMu.RLock()
+	defer c.subMu.RUnlock()
+	return len(c.subscriptions) > 0
+}
+
+// HandleFeedRequest applies a subscribe, unsubscribe or list request from a
+// feed client and acknowledges it. Subscribing with an existing ID replaces
+// that subscription's filters.
+func (c *Client) HandleFeedRequest(data []byte) {
+	var req FeedRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		c.SendJSON(FeedMessage{Type: "error", Error: "Invalid message: " + err.Error()})
+		return
+	}
+
+	sub := req.Subscription
+	switch req.Action {
+	case "subscribe":
+		if err := sub.validate(); err != nil {
+			c.SendJSON(FeedMessage{Type: "error", Subscription: &sub, Error: err.Error()})
+			return
+		}
+		c.subMu.Lock()
+		_, replacing := c.subscriptions[sub.ID]
+		if !replacing && len(c.subscriptions) >= maxSubscriptions {
+			c.subMu.Unlock()
+			c.SendJSON(FeedMessage{Type: "error", Subscription: &sub, Error: "Too many subscriptions"})
+			return
+		}
+		c.subscriptions[sub.ID] = sub
+		c.subMu.Unlock()
+		c.SendJSON(FeedMessage{Type: "subscribed", Subscription: &sub})
+	case "unsubscribe":
+		c.subMu.Lock()
+		existing, exists := c.subscriptions[sub.ID]
+		delete(c.subscriptions, sub.ID)
+		c.subMu.Unlock()
+		if !exists {
+			c.SendJSON(FeedMessage{Type: "error", Subscription: &sub, Error: "Unknown subscription"})
+			return
+		}
+		c.SendJSON(FeedMessage{Type: "unsubscribed", Subscription: &existing})
+	case "list":
+		c.subMu.RLock()
+		active := make([]Subscription, 0, len(c.subscriptions))
+		for _, s := range c.subscriptions {
+			active = append(active, s)
+		}
+		c.subMu.RUnlock()
+		c.SendJSON(FeedMessage{Type: "subscriptions", Active: active})
+	default:
+		c.SendJSON(FeedMessage{Type: "error", Error: "Unknown action: " + req.Action})
+	}
+}
+
+// sendUpdate queues message, an update of order, unless the client has
+// already been sent a newer state of the order. Consumers of different topics
+// broadcast concurrently and a new client's snapshot races the broadcasts, so
+// updates of one order can reach here out of order.
+func (c *Client) sendUpdate(order *OrderStatus, message []byte) {
+	c.versionMu.Lock()
+	defer c.versionMu.Unlock()
+
+	version := orderVersion(order)
+	if sent, ok := c.versions[order.OrderID]; ok && version < sent {
+		return
+	}
+	c.versions[order.OrderID] = version
+	c.Send(message)
+}
+
+func (c *Client) forget(orderID string) {
+	c.versionMu.Lock()
+	defer c.versionMu.Unlock()
+	delete(c.versions, orderID)
+}
+
+// SendJSON queues a feed message for this client.
+func (c *Client) SendJSON(message FeedMessage) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		slog.Error("Error marshaling feed message", "error", err)
+		return
+	}
+	c.Send(data)
+}
+
+// Send queues a message for this client only, evicting it if its queue is full.
+func (c *Client) Send(message []byte) {
+	select {
+	case <-c.done:
+	case c.send <- message:
+	default:
+		slog.Warn("Evicting slow WebSocket client", "order_id", c.orderID)
+		c.Close()
+	}
+}
+
+// Close unregisters the client and closes its connection. Safe to call more
+// than once and from any goroutine.
+func (c *Client) Close() {
+	c.closeOnce.Do(func() {
+		c.hub.unregister(c)
+		close(c.done)
+		c.conn.Close()
+	})
+}
+
+// ReadPump processes pongs, passes each incoming message to handle (if not
+// nil) and detects closed connections. It blocks until the connection fails.
+func (c *Client) ReadPump(handle func(message []byte)) {
+	defer c.Close()
+
+	c.conn.SetReadLimit(maxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		_, message, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				slog.Warn("WebSocket read error", "order_id", c.orderID, "error", err)
+			}
+			return
+		}
+		if handle != nil {
+			handle(message)
+		}
+	}
+}
+
+// writePump is the only goroutine that writes to the connection.
+func (c *Client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.Close()
+	}()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case message := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -3,36 +3,51 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
-	"sort"
 	"strconv"
-	"strings"
 	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 	"github.com/segmentio/kafka-go"
+
+	"shared/audit"
+	"shared/config"
+	"shared/health"
+	"shared/lag"
+	"shared/logging"
+	"shared/metrics"
+	"shared/tracing"
 )
 
 type OrderStatus struct {
-	OrderID           string            `json:"order_id"`
-	ProductID         string            `json:"product_id"`
-	Quantity          int               `json:"quantity"`
-	Status            string            `json:"status"`
-	Events            []EventRecord     `json:"events"`
-	LastUpdated       time.Time         `json:"last_updated"`
-	TrackingNumber    string            `json:"tracking_number,omitempty"`
-	PaymentAmount     float64           `json:"payment_amount,omitempty"`
+	OrderID            string            `json:"order_id"`
+	ProductID          string            `json:"product_id"`
+	CustomerID         string            `json:"customer_id,omitempty"`
+	Quantity           int               `json:"quantity"`
+	Status             string            `json:"status"`
+	NotificationStatus string            `json:"notification_status"`
+	FulfilmentStatus   string            `json:"fulfilment_status"`
+	Provisional        bool              `json:"provisional"` // true until OrderCreated has been seen
+	Events             []EventRecord     `json:"events"`
+	CreatedAt          time.Time         `json:"created_at"`
+	LastUpdated        time.Time         `json:"last_updated"`
+	LastEventAt        time.Time         `json:"last_event_at"`
+	TrackingNumber     string            `json:"tracking_number,omitempty"`
+	PaymentAmount      float64           `json:"payment_amount,omitempty"`
 }
 
 type EventRecord struct {
-	EventType string    `json:"event_type"`
-	Data      string    `json:"data"`
-	Timestamp time.Time `json:"timestamp"`
+	ID         string    `json:"id"`
+	EventType  string    `json:"event_type"`
+	Data       string    `json:"data"`
+	OccurredAt time.Time `json:"occurred_at"`
+	Timestamp  time.Time `json:"timestamp"`
 }
 
 type OrderStatistics struct {
@@ -56,231 +71,131 @@ type OrderFilter struct {
 }
 
 type StatusManager struct {
-	mu      sync.RWMutex
-	orders  map[string]*OrderStatus
-	clients map[string][]*websocket.Conn
+	storeMu sync.RWMutex
+	store   OrderStore
+	hub     *Hub
+	stream  *EventStream
 }
 
-func NewStatusManager() *StatusManager {
+func NewStatusManager(store OrderStore) *StatusManager {
 	return &StatusManager{
-		orders:  make(map[string]*OrderStatus),
-		clients: make(map[string][]*websocket.Conn),
+		store:  store,
+		hub:    NewHub(),
+		stream: NewEventStream(),
 	}
 }
 
-func (sm *StatusManager) UpdateOrderStatus(orderID string, eventType string, data interface{}) {
-	sm.mu.Lock()
-	defer sm.mu.Unlock()
-
-	order, exists := sm.orders[orderID]
-	if !exists {
-		order = &OrderStatus{
-			OrderID: orderID,
-			Status:  "created",
-			Events:  make([]EventRecord, 0),
-		}
-		sm.orders[orderID] = order
-	}
+func (sm *StatusManager) currentStore() OrderStore {
+	sm.storeMu.RLock()
+	defer sm.storeMu.RUnlock()
+	return sm.store
+}
 
-	dataBytes, _ := json.Marshal(data)
-	event := EventRecord{
-		EventType: eventType,
-		Data:      string(dataBytes),
-		Timestamp: time.Now(),
+// ReplaceStore promotes a rebuilt staging store to be the live projection and
+// pushes the rebuilt state to every connected WebSocket client. Feed clients
+// are told to resync, since any order may have changed.
+func (sm *StatusManager) ReplaceStore(staging OrderStore) error {
+	sm.storeMu.Lock()
+	promoted, err := sm.store.Promote(staging)
+	if err != nil {
+		sm.storeMu.Unlock()
+		return err
 	}
+	sm.store = promoted
+	sm.storeMu.Unlock()
 
-	order.Events = append(order.Events, event)
-	order.LastUpdated = time.Now()
-
-	switch eventType {
-	case "OrderCreated":
-		var orderData map[string]interface{}
-		json.Unmarshal(dataBytes, &orderData)
-		if productID, ok := orderData["product_id"].(string); ok {
-			order.ProductID = productID
-		}
-		if quantity, ok := orderData["quantity"].(float64); ok {
-			order.Quantity = int(quantity)
-		}
-		order.Status = "created"
-	case "InventoryConfirmed":
-		order.Status = "inventory_confirmed"
-	case "InventoryRejected":
-		order.Status = "inventory_rejected"
-	case "PaymentCompleted":
-		order.Status = "payment_completed"
-		var paymentData map[string]interface{}
-		json.Unmarshal(dataBytes, &paymentData)
-		if amount, ok := paymentData["amount"].(float64); ok {
-			order.PaymentAmount = amount
-		}
-	case "PaymentFailed":
-		order.Status = "payment_failed"
-	case "NotificationSent":
-		order.Status = "notification_sent"
-	case "Shipped":
-		order.Status = "shipped"
-		var shippingData map[string]interface{}
-		json.Unmarshal(dataBytes, &shippingData)
-		if trackingNumber, ok := shippingData["tracking_number"].(string); ok {
-			order.TrackingNumber = trackingNumber
+	sm.hub.ResetVersions()
+	for _, orderID := range sm.hub.OrderIDs() {
+		if order, exists, err := promoted.Get(orderID); err == nil && exists {
+			sm.hub.Broadcast(order)
 		}
 	}
-
-	sm.notifyClients(orderID, order)
+	sm.hub.Resync()
+	return nil
 }
 
-func (sm *StatusManager) notifyClients(orderID string, order *OrderStatus) {
-	clients, exists := sm.clients[orderID]
-	if !exists {
-		return
+func (sm *StatusManager) UpdateOrderStatus(event OrderEvent) error {
+	order, changed, err := applyEvent(sm.currentStore(), event)
+	if err != nil || !changed {
+		return err
 	}
 
-	message, _ := json.Marshal(order)
-	
-	activeClients := make([]*websocket.Conn, 0)
-	for _, conn := range clients {
-		if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
-			conn.Close()
-		} else {
-			activeClients = append(activeClients, conn)
+	sm.hub.Broadcast(order)
+	for _, record := range order.Events {
+		if record.ID == event.ID {
+			sm.stream.Publish(order, record)
+			break
 		}
 	}
-	
-	sm.clients[orderID] = activeClients
+	return nil
 }
 
-func (sm *StatusManager) AddClient(orderID string, conn *websocket.Conn) {
-	sm.mu.Lock()
-	defer sm.mu.Unlock()
-	
-	if sm.clients[orderID] == nil {
-		sm.clients[orderID] = make([]*websocket.Conn, 0)
+// applyEvent folds a single event into the order projection held by store.
+// changed is false when the event was a duplicate.
+func applyEvent(store OrderStore, event OrderEvent) (order *OrderStatus, changed bool, err error) {
+	order, err = store.Update(event.OrderID, func(current *OrderStatus) *OrderStatus {
+		updated := foldEvent(current, event)
+		changed = updated != nil
+		return updated
+	})
+	return order, changed, err
+}
+
+// AddClient registers a WebSocket connection for orderID and queues the
+// current state of the order as its first message.
+func (sm *StatusManager) AddClient(orderID string, conn *websocket.Conn) *Client {
+	client := sm.hub.Register(conn, orderID)
+
+	order, exists, err := sm.currentStore().Get(orderID)
+	if err != nil {
+		slog.Error("Error loading order for WebSocket client", "order_id", orderID, "error", err)
 	}
-	sm.clients[orderID] = append(sm.clients[orderID], conn)
-	
-	if order, exists := sm.orders[orderID]; exists {
+	if exists {
 		message, _ := json.Marshal(order)
-		conn.WriteMessage(websocket.TextMessage, message)
+		client.sendUpdate(order, message)
 	}
+	return client
 }
 
-func (sm *StatusManager) GetOrderStatus(orderID string) (*OrderStatus, bool) {
-	sm.mu.RLock()
-	defer sm.mu.RUnlock()
-	order, exists := sm.orders[orderID]
-	if !exists {
-		return nil, false
-	}
-	
-	orderCopy := *order
-	eventsCopy := make([]EventRecord, len(order.Events))
-	copy(eventsCopy, order.Events)
-	orderCopy.Events = eventsCopy
-	
-	return &orderCopy, true
+func (sm *StatusManager) GetOrderStatus(orderID string) (*OrderStatus, bool, error) {
+	return sm.currentStore().Get(orderID)
 }
 
-func (sm *StatusManager) GetAllOrders() map[string]*OrderStatus {
-	sm.mu.RLock()
-	defer sm.mu.RUnlock()
-	
-	result := make(map[string]*OrderStatus)
-	for k, v := range sm.orders {
-		orderCopy := *v
-		eventsCopy := make([]EventRecord, len(v.Events))
-		copy(eventsCopy, v.Events)
-		orderCopy.Events = eventsCopy
-		result[k] = &orderCopy
+func (sm *StatusManager) GetAllOrders() (map[string]*OrderStatus, error) {
+	orders, err := sm.currentStore().List()
+	if err != nil {
+		return nil, err
 	}
-	return result
-}
 
-func (sm *StatusManager) GetFilteredOrders(filter OrderFilter) []*OrderStatus {
-	sm.mu.RLock()
-	defer sm.mu.RUnlock()
-	
-	var result []*OrderStatus
-	
-	// Parse date filters
-	var dateFrom, dateTo time.Time
-	var err error
-	if filter.DateFrom != "" {
-		dateFrom, err = time.Parse("2006-01-02", filter.DateFrom)
-		if err != nil {
-			log.Printf("Invalid date_from format: %v", err)
-		}
-	}
-	if filter.DateTo != "" {
-		dateTo, err = time.Parse("2006-01-02", filter.DateTo)
-		if err != nil {
-			log.Printf("Invalid date_to format: %v", err)
-		}
-		dateTo = dateTo.Add(23*time.Hour + 59*time.Minute + 59*time.Second) // End of day
-	}
-	
-	for _, v := range sm.orders {
-		// Status filter
-		if filter.Status != "" && v.Status != filter.Status {
-			continue
-		}
-		
-		// Product filter
-		if filter.ProductID != "" && v.ProductID != filter.ProductID {
-			continue
-		}
-		
-		// Date filter
-		if !dateFrom.IsZero() && v.LastUpdated.Before(dateFrom) {
-			continue
-		}
-		if !dateTo.IsZero() && v.LastUpdated.After(dateTo) {
-			continue
-		}
-		
-		orderCopy := *v
-		eventsCopy := make([]EventRecord, len(v.Events))
-		copy(eventsCopy, v.Events)
-		orderCopy.Events = eventsCopy
-		result = append(result, &orderCopy)
-	}
-	
-	// Sort by last updated (newest first)
-	sort.Slice(result, func(i, j int) bool {
-		return result[i].LastUpdated.After(result[j].LastUpdated)
-	})
-	
-	// Apply pagination
-	if filter.Offset > 0 {
-		if filter.Offset >= len(result) {
-			return []*OrderStatus{}
-		}
-		result = result[filter.Offset:]
-	}
-	
-	if filter.Limit > 0 && filter.Limit < len(result) {
-		result = result[:filter.Limit]
+	result := make(map[string]*OrderStatus, len(orders))
+	for _, order := range orders {
+		result[order.OrderID] = order
 	}
-	
-	return result
+	return result, nil
 }
 
-func (sm *StatusManager) GetStatistics() OrderStatistics {
-	sm.mu.RLock()
-	defer sm.mu.RUnlock()
-	
+func (sm *StatusManager) GetFilteredOrders(filter OrderFilter) ([]*OrderStatus, error) {
+	return sm.currentStore().Filter(filter)
+}
+
+func (sm *StatusManager) GetStatistics() (OrderStatistics, error) {
 	stats := OrderStatistics{
 		OrdersByStatus:  make(map[string]int),
 		OrdersByProduct: make(map[string]int),
 		ProcessingTime:  make(map[string]string),
 	}
+
+	orders, err := sm.currentStore().List()
+	if err != nil {
+		return stats, err
+	}
 	
 	var totalRevenue float64
 	var completedOrders int
 	var recentOrders []*OrderStatus
 	
-	// Process all orders
-	for _, order := range sm.orders {
+	// Process all orders (newest first)
+	for _, order := range orders {
 		stats.TotalOrders++
 		
 		// Count by status
@@ -292,26 +207,17 @@ func (sm *StatusManager) GetStatistics() OrderStatistics {
 		}
 		
 		// Calculate revenue
-		if order.Status == "payment_completed" || order.Status == "shipped" {
+		if order.Status == StatusPaymentCompleted || order.Status == StatusShipped {
 			totalRevenue += order.PaymentAmount
 			completedOrders++
 		}
 		
 		// Collect recent orders (last 10)
 		if len(recentOrders) < 10 {
-			orderCopy := *order
-			eventsCopy := make([]EventRecord, len(order.Events))
-			copy(eventsCopy, order.Events)
-			orderCopy.Events = eventsCopy
-			recentOrders = append(recentOrders, &orderCopy)
+			recentOrders = append(recentOrders, order)
 		}
 	}
 	
-	// Sort recent orders by last updated
-	sort.Slice(recentOrders, func(i, j int) bool {
-		return recentOrders[i].LastUpdated.After(recentOrders[j].LastUpdated)
-	})
-	
 	stats.RecentOrders = recentOrders
 	stats.TotalRevenue = totalRevenue
 	
@@ -323,7 +229,7 @@ func (sm *StatusManager) GetStatistics() OrderStatistics {
 	// Calculate average processing times
 	processingTimes := make(map[string][]time.Duration)
 	
-	for _, order := range sm.orders {
+	for _, order := range orders {
 		if len(order.Events) >= 2 {
 			createdTime := order.Events[0].Timestamp
 			for i, event := range order.Events[1:] {
@@ -346,122 +252,98 @@ func (sm *StatusManager) GetStatistics() OrderStatistics {
 		}
 	}
 	
-	return stats
+	return stats, nil
 }
 
-func (sm *StatusManager) SearchOrders(query string) []*OrderStatus {
-	sm.mu.RLock()
-	defer sm.mu.RUnlock()
-	
-	var result []*OrderStatus
-	queryLower := strings.ToLower(query)
-	
-	for _, order := range sm.orders {
-		// Search in order ID, product ID, status, tracking number
-		if strings.Contains(strings.ToLower(order.OrderID), queryLower) ||
-		   strings.Contains(strings.ToLower(order.ProductID), queryLower) ||
-		   strings.Contains(strings.ToLower(order.Status), queryLower) ||
-		   strings.Contains(strings.ToLower(order.TrackingNumber), queryLower) {
-			
-			orderCopy := *order
-			eventsCopy := make([]EventRecord, len(order.Events))
-			copy(eventsCopy, order.Events)
-			orderCopy.Events = eventsCopy
-			result = append(result, &orderCopy)
-		}
-	}
-	
-	// Sort by relevance (exact matches first, then partial matches)
-	sort.Slice(result, func(i, j int) bool {
-		return result[i].LastUpdated.After(result[j].LastUpdated)
-	})
-	
-	return result
+func (sm *StatusManager) SearchOrders(query string) ([]*OrderStatus, error) {
+	return sm.currentStore().Search(query)
 }
 
-func (sm *StatusManager) DeleteOrder(orderID string) bool {
-	sm.mu.Lock()
-	defer sm.mu.Unlock()
-	
-	if _, exists := sm.orders[orderID]; exists {
-		delete(sm.orders, orderID)
-		// Also remove any WebSocket clients for this order
-		delete(sm.clients, orderID)
-		return true
+func (sm *StatusManager) DeleteOrder(orderID string) (bool, error) {
+	deleted, err := sm.currentStore().Delete(orderID)
+	if err != nil || !deleted {
+		return deleted, err
 	}
-	return false
+
+	// Also disconnect any WebSocket clients for this order
+	sm.hub.OrderDeleted(orderID)
+	return true, nil
 }
 
-func (sm *StatusManager) GetOrdersByDateRange(from, to time.Time) []*OrderStatus {
-	sm.mu.RLock()
-	defer sm.mu.RUnlock()
-	
-	var result []*OrderStatus
-	
-	for _, order := range sm.orders {
-		if order.LastUpdated.After(from) && order.LastUpdated.Before(to) {
-			orderCopy := *order
-			eventsCopy := make([]EventRecord, len(order.Events))
-			copy(eventsCopy, order.Events)
-			orderCopy.Events = eventsCopy
-			result = append(result, &orderCopy)
-		}
-	}
-	
-	sort.Slice(result, func(i, j int) bool {
-		return result[i].LastUpdated.After(result[j].LastUpdated)
-	})
-	
-	return result
+func (sm *StatusManager) GetOrdersByDateRange(from, to time.Time) ([]*OrderStatus, error) {
+	return sm.currentStore().DateRange(from, to)
 }
 
-var statusManager = NewStatusManager()
+var statusManager *StatusManager
+var rebuilder *Rebuilder
+var lagTracker *lag.Tracker
+
+// auditor publishes an AdminActionPerformed event for every admin change.
+var auditor = audit.NewPublisher("status-service", kafkaConn, cfg.Kafka.Topics.Audit)
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
 		return true
 	},
 }
 
-func getKafkaBroker() string {
-	if broker := os.Getenv("KAFKA_BROKER"); broker != "" {
-		return broker
-	}
-	return "localhost:9092"
-}
+// healthChecker backs /health, /health/live and /health/ready.
+var healthChecker = health.New("status-service")
 
 func consumeEvents(topic string) {
-	reader := kafka.NewReader(kafka.ReaderConfig{
-		Brokers: []string{getKafkaBroker()},
+	loop := healthChecker.Loop("consume-" + topic)
+	loop.Run()
+	defer loop.Exit()
+
+	reader := kafkaConn.Reader(kafka.ReaderConfig{
 		Topic:   topic,
-		GroupID: "status-service",
+		GroupID: cfg.Kafka.GroupID,
 	})
 	defer reader.Close()
 
 	for {
 		msg, err := reader.ReadMessage(context.Background())
 		if err != nil {
-			log.Printf("Error reading message from %s: %v", topic, err)
+			slog.Error("Error reading message", "topic", topic, "error", err)
+			loop.Fail(err)
 			continue
 		}
+		loop.Beat()
+		ctx, span := tracing.StartConsume(msg)
+		ctx = logging.WithEventID(ctx, logging.EventID(msg.Value))
+		start := time.Now()
 
-		var eventData map[string]interface{}
-		if err := json.Unmarshal(msg.Value, &eventData); err != nil {
-			log.Printf("Error unmarshaling message: %v", err)
-			continue
-		}
+		rebuilder.Apply(msg, func(msg kafka.Message) { handleMessage(ctx, msg) })
+		metrics.ObserveConsume(msg.Topic, start, nil)
+		tracing.End(span, nil)
+		lagTracker.Processed(msg)
+	}
+}
 
-		if orderID, ok := eventData["order_id"].(string); ok {
-			if eventType, ok := eventData["event_type"].(string); ok {
-				statusManager.UpdateOrderStatus(orderID, eventType, eventData)
-			}
-		}
+func handleMessage(ctx context.Context, msg kafka.Message) {
+	event, ok := parseEvent(msg)
+	if !ok {
+		return
+	}
+	ctx = logging.WithOrderID(ctx, event.OrderID)
+	tracing.OrderID(ctx, event.OrderID)
+	if err := statusManager.UpdateOrderStatus(event); err != nil {
+		slog.ErrorContext(ctx, "Error updating order", "topic", msg.Topic, "event_type", event.Type, "error", err)
 	}
 }
 
+func storeError(c *gin.Context, err error) {
+	slog.ErrorContext(c.Request.Context(), "Order store error", "error", err)
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Order store unavailable"})
+}
+
 func getOrderStatus(c *gin.Context) {
 	orderID := c.Param("orderId")
 	
-	order, exists := statusManager.GetOrderStatus(orderID)
+	order, exists, err := statusManager.GetOrderStatus(orderID)
+	if err != nil {
+		storeError(c, err)
+		return
+	}
 	if !exists {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
 		return
@@ -471,7 +353,11 @@ func getOrderStatus(c *gin.Context) {
 }
 
 func getAllOrders(c *gin.Context) {
-	orders := statusManager.GetAllOrders()
+	orders, err := statusManager.GetAllOrders()
+	if err != nil {
+		storeError(c, err)
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{"orders": orders})
 }
 
@@ -480,25 +366,39 @@ func websocketHandler(c *gin.Context) {
 	
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
-		log.Printf("WebSocket upgrade error: %v", err)
+		slog.WarnContext(c.Request.Context(), "WebSocket upgrade error", "order_id", orderID, "error", err)
 		return
 	}
-	defer conn.Close()
 
-	statusManager.AddClient(orderID, conn)
-	log.Printf("WebSocket connection established for order: %s", orderID)
+	client := statusManager.AddClient(orderID, conn)
+	slog.InfoContext(c.Request.Context(), "WebSocket connection established", "order_id", orderID)
 
-	for {
-		_, _, err := conn.ReadMessage()
-		if err != nil {
-			log.Printf("WebSocket read error: %v", err)
-			break
-		}
+	client.ReadPump(nil)
+}
+
+// feedWebsocketHandler serves the multi-order feed. Clients send
+// {"action":"subscribe","subscription":{"id":"...","status":"shipped"}} (or
+// "unsubscribe"/"list") and receive order_update messages for every order
+// matching one of their subscriptions.
+func feedWebsocketHandler(c *gin.Context) {
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		slog.WarnContext(c.Request.Context(), "WebSocket upgrade error", "error", err)
+		return
 	}
+
+	client := statusManager.hub.Register(conn, "")
+	slog.InfoContext(c.Request.Context(), "WebSocket feed connection established")
+
+	client.ReadPump(client.HandleFeedRequest)
 }
 
 func getStatistics(c *gin.Context) {
-	stats := statusManager.GetStatistics()
+	stats, err := statusManager.GetStatistics()
+	if err != nil {
+		storeError(c, err)
+		return
+	}
 	c.JSON(http.StatusOK, stats)
 }
 
@@ -523,7 +423,11 @@ func getFilteredOrders(c *gin.Context) {
 		}
 	}
 	
-	orders := statusManager.GetFilteredOrders(filter)
+	orders, err := statusManager.GetFilteredOrders(filter)
+	if err != nil {
+		storeError(c, err)
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"orders": orders,
 		"count":  len(orders),
@@ -538,7 +442,11 @@ func searchOrders(c *gin.Context) {
 		return
 	}
 	
-	orders := statusManager.SearchOrders(query)
+	orders, err := statusManager.SearchOrders(query)
+	if err != nil {
+		storeError(c, err)
+		return
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"orders": orders,
 		"count":  len(orders),
@@ -549,7 +457,18 @@ func searchOrders(c *gin.Context) {
 func deleteOrder(c *gin.Context) {
 	orderID := c.Param("orderId")
 	
-	if statusManager.DeleteOrder(orderID) {
+	before, _, err := statusManager.GetOrderStatus(orderID)
+	if err != nil {
+		storeError(c, err)
+		return
+	}
+	deleted, err := statusManager.DeleteOrder(orderID)
+	if err != nil {
+		storeError(c, err)
+		return
+	}
+	if deleted {
+		auditor.Record(c, "order.delete", "order/"+orderID, before, nil)
 		c.JSON(http.StatusOK, gin.H{
 			"message": "Order deleted successfully",
 			"order_id": orderID,
@@ -563,7 +482,11 @@ func getOrdersByStatus(c *gin.Context) {
 	status := c.Param("status")
 	
 	filter := OrderFilter{Status: status}
-	orders := statusManager.GetFilteredOrders(filter)
+	orders, err := statusManager.GetFilteredOrders(filter)
+	if err != nil {
+		storeError(c, err)
+		return
+	}
 	
 	c.JSON(http.StatusOK, gin.H{
 		"orders": orders,
@@ -576,7 +499,11 @@ func getOrdersByProduct(c *gin.Context) {
 	productID := c.Param("productId")
 	
 	filter := OrderFilter{ProductID: productID}
-	orders := statusManager.GetFilteredOrders(filter)
+	orders, err := statusManager.GetFilteredOrders(filter)
+	if err != nil {
+		storeError(c, err)
+		return
+	}
 	
 	c.JSON(http.StatusOK, gin.H{
 		"orders": orders,
@@ -597,7 +524,11 @@ func getDailyReport(c *gin.Context) {
 	from := date
 	to := date.Add(23*time.Hour + 59*time.Minute + 59*time.Second)
 	
-	orders := statusManager.GetOrdersByDateRange(from, to)
+	orders, err := statusManager.GetOrdersByDateRange(from, to)
+	if err != nil {
+		storeError(c, err)
+		return
+	}
 	
 	// Generate daily statistics
 	statusCounts := make(map[string]int)
@@ -609,7 +540,7 @@ func getDailyReport(c *gin.Context) {
 		if order.ProductID != "" {
 			productCounts[order.ProductID]++
 		}
-		if order.Status == "payment_completed" || order.Status == "shipped" {
+		if order.Status == StatusPaymentCompleted || order.Status == StatusShipped {
 			totalRevenue += order.PaymentAmount
 		}
 	}
@@ -627,7 +558,11 @@ func getDailyReport(c *gin.Context) {
 func getOrderEvents(c *gin.Context) {
 	orderID := c.Param("orderId")
 	
-	order, exists := statusManager.GetOrderStatus(orderID)
+	order, exists, err := statusManager.GetOrderStatus(orderID)
+	if err != nil {
+		storeError(c, err)
+		return
+	}
 	if !exists {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
 		return
@@ -654,7 +589,18 @@ func bulkDeleteOrders(c *gin.Context) {
 	notFound := 0
 	
 	for _, orderID := range request.OrderIDs {
-		if statusManager.DeleteOrder(orderID) {
+		before, _, err := statusManager.GetOrderStatus(orderID)
+		if err != nil {
+			storeError(c, err)
+			return
+		}
+		ok, err := statusManager.DeleteOrder(orderID)
+		if err != nil {
+			storeError(c, err)
+			return
+		}
+		if ok {
+			auditor.Record(c, "order.bulk_delete", "order/"+orderID, before, nil)
 			deleted++
 		} else {
 			notFound++
@@ -668,18 +614,80 @@ func bulkDeleteOrders(c *gin.Context) {
 	})
 }
 
-func healthCheck(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"status": "healthy", "service": "status-service"})
+func startRebuild(c *gin.Context) {
+	progress, err := rebuilder.Start("admin request")
+	if err == errRebuildRunning {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "progress": rebuilder.Progress()})
+		return
+	}
+	auditor.Record(c, "status.rebuild.start", "rebuild/"+progress.ID, nil, progress)
+	c.JSON(http.StatusAccepted, progress)
+}
+
+func getRebuildProgress(c *gin.Context) {
+	progress := rebuilder.Progress()
+	if progress == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No rebuild has been run"})
+		return
+	}
+	c.JSON(http.StatusOK, progress)
 }
 
 func main() {
-	topics := []string{"orders", "inventory", "payment", "notification", "shipping"}
-	
+	metrics.Init("status-service")
+	tracing.Init("status-service")
+	kafkaConn.MustEnsureTopics(context.Background())
+	go auditor.CheckTopic(context.Background())
+
+	rebuildOnStart := flag.Bool("rebuild", false, "rebuild order status by replaying all topics from the earliest offset")
+	flag.Parse()
+
+	store, err := newOrderStore()
+	if err != nil {
+		slog.Error("Failed to initialize order store", "error", err)
+		os.Exit(1)
+	}
+	defer store.Close()
+	statusManager = NewStatusManager(store)
+
+	topics := []string{
+		cfg.Kafka.Topics.Orders,
+		cfg.Kafka.Topics.Inventory,
+		cfg.Kafka.Topics.Payment,
+		cfg.Kafka.Topics.Notification,
+		cfg.Kafka.Topics.Shipping,
+	}
+	rebuilder = NewRebuilder(statusManager, topics)
+	lagTracker = lag.NewTracker("status-service", cfg.Kafka.GroupID, kafkaConn, topics...)
+
 	for _, topic := range topics {
 		go consumeEvents(topic)
 	}
 
-	r := gin.Default()
+	healthChecker.AddCheck("kafka", health.KafkaCheck(kafkaConn))
+	healthChecker.AddCheck("storage", func(ctx context.Context) error {
+		return statusManager.currentStore().Ping(ctx)
+	})
+
+	// The in-memory store starts empty, so always rebuild it from the full
+	// topic history. Until the rebuild finishes the service is not ready.
+	if _, inMemory := store.(*MemoryStore); inMemory || *rebuildOnStart || cfg.Features.RebuildOnStart {
+		if _, err := rebuilder.Start("startup"); err != nil {
+			slog.Error("Startup rebuild failed", "error", err)
+		} else {
+			done := healthChecker.WarmUp("rebuild")
+			go func() {
+				rebuilder.Wait()
+				done()
+			}()
+		}
+	}
+
+	r := gin.New()
+	r.Use(gin.Recovery())
+	r.Use(tracing.Middleware())
+	r.Use(logging.Middleware())
+	r.Use(metrics.Middleware())
 	
 	// CORS middleware
 	r.Use(func(c *gin.Context) {
@@ -694,12 +702,20 @@ func main() {
 		
 		c.Next()
 	})
+	r.Use(authn.Middleware("/admin"))
+	r.Use(authn.Authorize("status-service"))
 	
 	// Existing endpoints
 	r.GET("/status/:orderId", getOrderStatus)
 	r.GET("/orders", getAllOrders)
 	r.GET("/ws/:orderId", websocketHandler)
-	r.GET("/health", healthCheck)
+	r.GET("/ws", feedWebsocketHandler)
+	r.GET("/events/stream", streamAllEvents)
+	r.GET("/status/:orderId/stream", streamOrderEvents)
+	healthChecker.Register(r)
+	metrics.Register(r)
+	config.Register(r, cfg)
+	lagTracker.Register(r)
 	
 	// New management endpoints
 	r.GET("/statistics", getStatistics)
@@ -711,18 +727,10 @@ func main() {
 	r.GET("/reports/daily/:date", getDailyReport)
 	r.DELETE("/orders/:orderId", deleteOrder)
 	r.POST("/orders/bulk-delete", bulkDeleteOrders)
+	r.POST("/admin/rebuild", startRebuild)
+	r.GET("/admin/rebuild", getRebuildProgress)
 
-	log.Printf("Status Service starting on port :8087")
-	log.Println("Management API endpoints:")
-	log.Println("  GET    /statistics               - Get order statistics")
-	log.Println("  GET    /orders/filtered          - Get filtered orders")
-	log.Println("  GET    /orders/search?q=query    - Search orders")
-	log.Println("  GET    /orders/status/:status    - Get orders by status")
-	log.Println("  GET    /orders/product/:productId - Get orders by product")
-	log.Println("  GET    /orders/:orderId/events   - Get order event history")
-	log.Println("  GET    /reports/daily/:date      - Get daily report")
-	log.Println("  DELETE /orders/:orderId          - Delete order")
-	log.Println("  POST   /orders/bulk-delete       - Bulk delete orders")
-	
-	r.Run(":8087")
+	slog.Info("Status Service starting", "addr", cfg.Addr())
+	
+	r.Run(cfg.Addr())
 }
\ No newline at end of file
@@ -0,0 +1,488 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// postgresTables is the schema for one copy of the projection. Table and index
+// names use {orders} and {events} placeholders so a rebuild can fill a staging
+// copy and rename it over the live one.
+var postgresTables = []string{
+	`CREATE TABLE IF NOT EXISTS {orders} (
+		order_id            VARCHAR(255) PRIMARY KEY,
+		product_id          VARCHAR(255) NOT NULL DEFAULT '',
+		customer_id         VARCHAR(255) NOT NULL DEFAULT '',
+		quantity            INTEGER NOT NULL DEFAULT 0,
+		status              VARCHAR(50) NOT NULL,
+		notification_status VARCHAR(50) NOT NULL DEFAULT '',
+		fulfilment_status   VARCHAR(50) NOT NULL DEFAULT '',
+		provisional         BOOLEAN NOT NULL DEFAULT false,
+		tracking_number     VARCHAR(255) NOT NULL DEFAULT '',
+		payment_amount      DECIMAL(12,2) NOT NULL DEFAULT 0,
+		created_at          TIMESTAMPTZ NOT NULL DEFAULT now(),
+		last_updated        TIMESTAMPTZ NOT NULL,
+		last_event_at       TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`,
+	`CREATE TABLE IF NOT EXISTS {events} (
+		id          BIGSERIAL PRIMARY KEY,
+		event_id    VARCHAR(64) NOT NULL DEFAULT '',
+		order_id    VARCHAR(255) NOT NULL,
+		event_type  VARCHAR(100) NOT NULL,
+		data        JSONB,
+		occurred_at TIMESTAMPTZ NOT NULL,
+		received_at TIMESTAMPTZ
+	)`,
+	// Columns added after the first release of the schema.
+	`ALTER TABLE {orders} ADD COLUMN IF NOT EXISTS notification_status VARCHAR(50) NOT NULL DEFAULT ''`,
+	`ALTER TABLE {orders} ADD COLUMN IF NOT EXISTS fulfilment_status VARCHAR(50) NOT NULL DEFAULT ''`,
+	`ALTER TABLE {orders} ADD COLUMN IF NOT EXISTS last_event_at TIMESTAMPTZ NOT NULL DEFAULT now()`,
+	`ALTER TABLE {orders} ADD COLUMN IF NOT EXISTS provisional BOOLEAN NOT NULL DEFAULT false`,
+	`ALTER TABLE {orders} ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now()`,
+	`ALTER TABLE {orders} ADD COLUMN IF NOT EXISTS customer_id VARCHAR(255) NOT NULL DEFAULT ''`,
+	`ALTER TABLE {events} ADD COLUMN IF NOT EXISTS event_id VARCHAR(64) NOT NULL DEFAULT ''`,
+	`ALTER TABLE {events} ADD COLUMN IF NOT EXISTS received_at TIMESTAMPTZ`,
+}
+
+// postgresIndex backs Filter, Search and DateRange. Optional indexes need the
+// pg_trgm extension, which init-db.sql installs; without it Search still works
+// but falls back to sequential scans.
+type postgresIndex struct {
+	name     string
+	create   string
+	optional bool
+}
+
+var postgresIndexes = []postgresIndex{
+	{name: "idx_{orders}_last_updated", create: `ON {orders} (last_updated DESC)`},
+	{name: "idx_{orders}_status", create: `ON {orders} (status, last_updated DESC)`},
+	{name: "idx_{orders}_product", create: `ON {orders} (product_id, last_updated DESC)`},
+	{name: "idx_{events}_order", create: `ON {events} (order_id, occurred_at, id)`},
+	{name: "idx_{orders}_order_trgm", create: `ON {orders} USING gin (lower(order_id) gin_trgm_ops)`, optional: true},
+	{name: "idx_{orders}_product_trgm", create: `ON {orders} USING gin (lower(product_id) gin_trgm_ops)`, optional: true},
+	{name: "idx_{orders}_tracking_trgm", create: `ON {orders} USING gin (lower(tracking_number) gin_trgm_ops)`, optional: true},
+}
+
+const (
+	liveOrdersTable    = "status_orders"
+	liveEventsTable    = "status_order_events"
+	stagingTableSuffix = "_rebuild"
+)
+
+const orderColumns = `order_id, product_id, quantity, status, notification_status, fulfilment_status,
+	provisional, tracking_number, payment_amount, created_at, last_updated, last_event_at, customer_id`
+
+// PostgresStore persists order projections in Postgres so they survive
+// restarts and are shared between status-service replicas.
+type PostgresStore struct {
+	db          *sql.DB
+	ordersTable string
+	eventsTable string
+}
+
+func NewPostgresStore(dsn string) (*PostgresStore, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("open postgres: %w", err)
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("connect to postgres: %w", err)
+	}
+
+	store := &PostgresStore{db: db, ordersTable: liveOrdersTable, eventsTable: liveEventsTable}
+	if err := store.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// sql substitutes this store's table names into a query template.
+func (ps *PostgresStore) sql(query string) string {
+	return strings.NewReplacer("{orders}", ps.ordersTable, "{events}", ps.eventsTable).Replace(query)
+}
+
+func (ps *PostgresStore) migrate() error {
+	for _, stmt := range postgresTables {
+		if _, err := ps.db.Exec(ps.sql(stmt)); err != nil {
+			return fmt.Errorf("migrate status schema: %w", err)
+		}
+	}
+	for _, index := range postgresIndexes {
+		stmt := ps.sql("CREATE INDEX IF NOT EXISTS " + index.name + " " + index.create)
+		if _, err := ps.db.Exec(stmt); err != nil {
+			if !index.optional {
+				return fmt.Errorf("migrate status schema: %w", err)
+			}
+			slog.Warn("Skipping search index (is pg_trgm installed?)", "error", err)
+		}
+	}
+	return nil
+}
+
+// Staging drops any leftover staging tables and creates empty ones for a
+// rebuild to fill.
+func (ps *PostgresStore) Staging() (OrderStore, error) {
+	staging := &PostgresStore{
+		db:          ps.db,
+		ordersTable: ps.ordersTable + stagingTableSuffix,
+		eventsTable: ps.eventsTable + stagingTableSuffix,
+	}
+	if _, err := ps.db.Exec(staging.sql(`DROP TABLE IF EXISTS {events}, {orders}`)); err != nil {
+		return nil, fmt.Errorf("drop staging tables: %w", err)
+	}
+	if err := staging.migrate(); err != nil {
+		return nil, err
+	}
+	return staging, nil
+}
+
+// Promote swaps the staging tables in place of the live ones in a single
+// transaction, renaming their indexes, keys and sequence to the live names.
+func (ps *PostgresStore) Promote(staging OrderStore) (OrderStore, error) {
+	from, ok := staging.(*PostgresStore)
+	if !ok {
+		return nil, fmt.Errorf("cannot promote %T into postgres store", staging)
+	}
+
+	tx, err := ps.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stmts := []string{
+		fmt.Sprintf(`DROP TABLE IF EXISTS %s, %s`, ps.eventsTable, ps.ordersTable),
+		fmt.Sprintf(`ALTER TABLE %s RENAME TO %s`, from.ordersTable, ps.ordersTable),
+		fmt.Sprintf(`ALTER TABLE %s RENAME TO %s`, from.eventsTable, ps.eventsTable),
+		fmt.Sprintf(`ALTER TABLE %s RENAME CONSTRAINT %s_pkey TO %s_pkey`, ps.ordersTable, from.ordersTable, ps.ordersTable),
+		fmt.Sprintf(`ALTER TABLE %s RENAME CONSTRAINT %s_pkey TO %s_pkey`, ps.eventsTable, from.eventsTable, ps.eventsTable),
+		fmt.Sprintf(`ALTER SEQUENCE %s_id_seq RENAME TO %s_id_seq`, from.eventsTable, ps.eventsTable),
+	}
+	for _, index := range postgresIndexes {
+		stmts = append(stmts, fmt.Sprintf(`ALTER INDEX IF EXISTS %s RENAME TO %s`, from.sql(index.name), ps.sql(index.name)))
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return nil, fmt.Errorf("promote rebuilt projection: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return ps, nil
+}
+
+// lockOrder takes, until tx ends, a shared lock on the whole table, which
+// LockWrites takes exclusively, and an exclusive lock on orderID. The table
+// lock uses the one-key form and the order lock the two-key form, whose key
+// spaces do not overlap.
+func (ps *PostgresStore) lockOrder(tx *sql.Tx, orderID string) error {
+	if _, err := tx.Exec(ps.sql(`SELECT pg_advisory_xact_lock_shared(hashtext('{orders}'))`)); err != nil {
+		return fmt.Errorf("lock %s: %w", ps.ordersTable, err)
+	}
+	if _, err := tx.Exec(ps.sql(`SELECT pg_advisory_xact_lock(hashtext('{orders}'), hashtext($1))`), orderID); err != nil {
+		return fmt.Errorf("lock order %s: %w", orderID, err)
+	}
+	return nil
+}
+
+// LockWrites takes the table lock exclusively on a dedicated connection, so
+// it waits for writes in progress in every replica and holds back new ones.
+func (ps *PostgresStore) LockWrites(ctx context.Context) (func(), error) {
+	conn, err := ps.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.ExecContext(ctx, ps.sql(`SELECT pg_advisory_lock(hashtext('{orders}'))`)); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("lock %s for writes: %w", ps.ordersTable, err)
+	}
+	return func() {
+		if _, err := conn.ExecContext(context.Background(), ps.sql(`SELECT pg_advisory_unlock(hashtext('{orders}'))`)); err != nil {
+			// Discard the connection rather than pool it still holding the
+			// lock; closing the session releases it.
+			slog.Error("Error unlocking order store", "table", ps.ordersTable, "error", err)
+			conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+		}
+		conn.Close()
+	}, nil
+}
+
+func (ps *PostgresStore) Get(orderID string) (*OrderStatus, bool, error) {
+	orders, err := ps.query(`SELECT `+orderColumns+` FROM {orders} WHERE order_id = $1`, orderID)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(orders) == 0 {
+		return nil, false, nil
+	}
+	return orders[0], true, nil
+}
+
+func (ps *PostgresStore) Update(orderID string, fn func(order *OrderStatus) *OrderStatus) (*OrderStatus, error) {
+	tx, err := ps.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Serialize updates to the order so concurrent consumers (possibly in
+	// other replicas) apply their events one at a time. A row lock alone is
+	// not enough: before the first event there is no row to lock, and two
+	// first events would both fold from nil with one upsert overwriting the
+	// other.
+	if err := ps.lockOrder(tx, orderID); err != nil {
+		return nil, err
+	}
+	row := tx.QueryRow(ps.sql(`SELECT `+orderColumns+` FROM {orders} WHERE order_id = $1 FOR UPDATE`), orderID)
+	current, err := scanOrder(row)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	knownEvents := make(map[string]bool)
+	if current != nil {
+		if err := ps.loadEvents(tx, []*OrderStatus{current}); err != nil {
+			return nil, err
+		}
+		for _, event := range current.Events {
+			knownEvents[event.ID] = true
+		}
+	}
+
+	updated := fn(current)
+	if updated == nil {
+		return current, nil
+	}
+
+	_, err = tx.Exec(ps.sql(`
+		INSERT INTO {orders} (`+orderColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		ON CONFLICT (order_id) DO UPDATE SET
+			product_id = EXCLUDED.product_id,
+			quantity = EXCLUDED.quantity,
+			status = EXCLUDED.status,
+			notification_status = EXCLUDED.notification_status,
+			fulfilment_status = EXCLUDED.fulfilment_status,
+			provisional = EXCLUDED.provisional,
+			tracking_number = EXCLUDED.tracking_number,
+			payment_amount = EXCLUDED.payment_amount,
+			created_at = EXCLUDED.created_at,
+			last_updated = EXCLUDED.last_updated,
+			last_event_at = EXCLUDED.last_event_at,
+			customer_id = EXCLUDED.customer_id`),
+		updated.OrderID, updated.ProductID, updated.Quantity, updated.Status,
+		updated.NotificationStatus, updated.FulfilmentStatus, updated.Provisional,
+		updated.TrackingNumber, updated.PaymentAmount, updated.CreatedAt, updated.LastUpdated, updated.LastEventAt,
+		updated.CustomerID)
+	if err != nil {
+		return nil, fmt.Errorf("upsert order %s: %w", orderID, err)
+	}
+
+	for _, event := range updated.Events {
+		if knownEvents[event.ID] {
+			continue
+		}
+		_, err := tx.Exec(ps.sql(`
+			INSERT INTO {events} (event_id, order_id, event_type, data, occurred_at, received_at)
+			VALUES ($1, $2, $3, $4, $5, $6)`),
+			event.ID, orderID, event.EventType, event.Data, event.OccurredAt, event.Timestamp)
+		if err != nil {
+			return nil, fmt.Errorf("insert event for order %s: %w", orderID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+func (ps *PostgresStore) Delete(orderID string) (bool, error) {
+	tx, err := ps.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if err := ps.lockOrder(tx, orderID); err != nil {
+		return false, err
+	}
+
+	if _, err := tx.Exec(ps.sql(`DELETE FROM {events} WHERE order_id = $1`), orderID); err != nil {
+		return false, err
+	}
+	result, err := tx.Exec(ps.sql(`DELETE FROM {orders} WHERE order_id = $1`), orderID)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, tx.Commit()
+}
+
+func (ps *PostgresStore) List() ([]*OrderStatus, error) {
+	return ps.query(`SELECT ` + orderColumns + ` FROM {orders} ORDER BY last_updated DESC`)
+}
+
+func (ps *PostgresStore) Filter(filter OrderFilter) ([]*OrderStatus, error) {
+	var conditions []string
+	var args []interface{}
+	addCondition := func(clause string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(clause, len(args)))
+	}
+
+	if filter.Status != "" {
+		addCondition("status = $%d", filter.Status)
+	}
+	if filter.ProductID != "" {
+		addCondition("product_id = $%d", filter.ProductID)
+	}
+	dateFrom, dateTo := filter.dateRange()
+	if !dateFrom.IsZero() {
+		addCondition("last_updated >= $%d", dateFrom)
+	}
+	if !dateTo.IsZero() {
+		addCondition("last_updated <= $%d", dateTo)
+	}
+
+	query := `SELECT ` + orderColumns + ` FROM {orders}`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	query += ` ORDER BY last_updated DESC`
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(` LIMIT $%d`, len(args))
+	}
+	if filter.Offset > 0 {
+		args = append(args, filter.Offset)
+		query += fmt.Sprintf(` OFFSET $%d`, len(args))
+	}
+
+	return ps.query(query, args...)
+}
+
+func (ps *PostgresStore) Search(query string) ([]*OrderStatus, error) {
+	pattern := "%" + escapeLike(strings.ToLower(query)) + "%"
+	return ps.query(`
+		SELECT `+orderColumns+` FROM {orders}
+		WHERE lower(order_id) LIKE $1
+		   OR lower(product_id) LIKE $1
+		   OR lower(status) LIKE $1
+		   OR lower(tracking_number) LIKE $1
+		ORDER BY last_updated DESC`, pattern)
+}
+
+func (ps *PostgresStore) DateRange(from, to time.Time) ([]*OrderStatus, error) {
+	return ps.query(`
+		SELECT `+orderColumns+` FROM {orders}
+		WHERE last_updated > $1 AND last_updated < $2
+		ORDER BY last_updated DESC`, from, to)
+}
+
+func (ps *PostgresStore) Ping(ctx context.Context) error {
+	return ps.db.PingContext(ctx)
+}
+
+func (ps *PostgresStore) Close() error {
+	return ps.db.Close()
+}
+
+// query runs an order select and attaches each order's event history.
+func (ps *PostgresStore) query(query string, args ...interface{}) ([]*OrderStatus, error) {
+	rows, err := ps.db.Query(ps.sql(query), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orders := make([]*OrderStatus, 0)
+	for rows.Next() {
+		order, err := scanOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := ps.loadEvents(ps.db, orders); err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func scanOrder(row rowScanner) (*OrderStatus, error) {
+	order := &OrderStatus{Events: make([]EventRecord, 0)}
+	err := row.Scan(&order.OrderID, &order.ProductID, &order.Quantity, &order.Status,
+		&order.NotificationStatus, &order.FulfilmentStatus, &order.Provisional,
+		&order.TrackingNumber, &order.PaymentAmount, &order.CreatedAt, &order.LastUpdated, &order.LastEventAt,
+		&order.CustomerID)
+	if err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// loadEvents fetches the event history for all given orders in one query.
+func (ps *PostgresStore) loadEvents(q queryer, orders []*OrderStatus) error {
+	if len(orders) == 0 {
+		return nil
+	}
+
+	byID := make(map[string]*OrderStatus, len(orders))
+	ids := make([]string, 0, len(orders))
+	for _, order := range orders {
+		byID[order.OrderID] = order
+		ids = append(ids, order.OrderID)
+	}
+
+	rows, err := q.Query(ps.sql(`
+		SELECT event_id, order_id, event_type, COALESCE(data::text, ''), occurred_at, COALESCE(received_at, occurred_at)
+		FROM {events}
+		WHERE order_id = ANY($1)
+		ORDER BY order_id, occurred_at, id`), pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var orderID string
+		var event EventRecord
+		if err := rows.Scan(&event.ID, &orderID, &event.EventType, &event.Data, &event.OccurredAt, &event.Timestamp); err != nil {
+			return err
+		}
+		if order, ok := byID[orderID]; ok {
+			order.Events = append(order.Events, event)
+		}
+	}
+	return rows.Err()
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
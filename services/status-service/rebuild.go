@@ -0,0 +1,366 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// partitionRange is the span of offsets [First, End) present in a partition
+// when a rebuild starts.
+type partitionRange struct {
+	First int64
+	End   int64
+}
+
+// readPartitionRanges captures the current first and end offsets of every
+// partition of topic.
+func readPartitionRanges(ctx context.Context, topic string) (map[int]partitionRange, error) {
+	partitions, err := kafkaConn.LookupPartitions(ctx, topic)
+	if err != nil {
+		return nil, fmt.Errorf("lookup partitions for %s: %w", topic, err)
+	}
+
+	ranges := make(map[int]partitionRange, len(partitions))
+	for _, p := range partitions {
+		conn, err := kafkaConn.DialPartition(ctx, p)
+		if err != nil {
+			return nil, fmt.Errorf("dial leader for %s/%d: %w", topic, p.ID, err)
+		}
+		first, last, err := conn.ReadOffsets()
+		conn.Close()
+		if err != nil {
+			return nil, fmt.Errorf("read offsets for %s/%d: %w", topic, p.ID, err)
+		}
+		ranges[p.ID] = partitionRange{First: first, End: last}
+	}
+	return ranges, nil
+}
+
+// replayTopic re-reads the offsets [First, End) in ranges of each partition of
+// topic. It uses partition readers, which join no consumer group, so the live
+// group's offsets are left untouched and the broker is left no group to clean
+// up.
+func replayTopic(ctx context.Context, topic string, ranges map[int]partitionRange, handle func(kafka.Message)) error {
+	for partition, r := range ranges {
+		if err := replayPartition(ctx, topic, partition, r, handle); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replayPartition hands every message of partition in r to handle. The
+// partition is done once a message at or past End-1 arrives: the message at
+// End-1 itself may never come, for example when it is a transaction marker,
+// but a later one will. A partition that delivers nothing for
+// cfg.Rebuild.IdleTimeout fails the replay.
+func replayPartition(ctx context.Context, topic string, partition int, r partitionRange, handle func(kafka.Message)) error {
+	if r.End <= r.First {
+		return nil
+	}
+
+	reader := kafkaConn.Reader(kafka.ReaderConfig{Topic: topic, Partition: partition})
+	defer reader.Close()
+	if err := reader.SetOffset(r.First); err != nil {
+		return fmt.Errorf("replay %s/%d: %w", topic, partition, err)
+	}
+
+	for {
+		fetchCtx, cancel := context.WithTimeout(ctx, cfg.Rebuild.IdleTimeout)
+		msg, err := reader.FetchMessage(fetchCtx)
+		cancel()
+		if err != nil {
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+				return fmt.Errorf("replay %s/%d: no message for %s, stopped before offset %d of %d",
+					topic, partition, cfg.Rebuild.IdleTimeout, reader.Offset(), r.End)
+			}
+			return fmt.Errorf("replay %s/%d: %w", topic, partition, err)
+		}
+
+		if msg.Offset < r.End {
+			handle(msg)
+		}
+		if msg.Offset >= r.End-1 {
+			return nil
+		}
+	}
+}
+
+// TopicProgress reports how far a rebuild has got through one topic.
+type TopicProgress struct {
+	Processed int64 `json:"processed"`
+	Total     int64 `json:"total"`
+}
+
+// RebuildProgress is the externally visible state of the latest rebuild.
+type RebuildProgress struct {
+	ID         string                    `json:"id"`
+	Status     string                    `json:"status"` // running, completed, failed
+	Reason     string                    `json:"reason"`
+	StartedAt  time.Time                 `json:"started_at"`
+	FinishedAt *time.Time                `json:"finished_at,omitempty"`
+	Processed  int64                     `json:"processed"`
+	Total      int64                     `json:"total"`
+	Percent    float64                   `json:"percent"`
+	Topics     map[string]*TopicProgress `json:"topics"`
+	Error      string                    `json:"error,omitempty"`
+}
+
+var errRebuildRunning = errors.New("rebuild already in progress")
+
+// Rebuilder resets the status projection by replaying every topic from the
+// earliest offset into a staging store and then swapping it in. Before the
+// swap it stops every writer to the live store, in this replica and any other
+// sharing it, and replays what arrived during the rebuild, so nothing written
+// meanwhile is lost. A writer held back by the swap may then apply a message
+// the rebuild already replayed; the event ID makes that a no-op.
+type Rebuilder struct {
+	sm     *StatusManager
+	topics []string
+
+	// mu is held for reading while a live message is applied and for writing
+	// while the rebuilt projection is caught up and swapped in.
+	mu sync.RWMutex
+
+	progressMu sync.RWMutex
+	progress   *RebuildProgress
+	processed  map[string]*int64
+	done       chan struct{} // closed when the current rebuild finishes
+}
+
+func NewRebuilder(sm *StatusManager, topics []string) *Rebuilder {
+	return &Rebuilder{sm: sm, topics: topics}
+}
+
+// Apply handles a live message, waiting while a rebuild is being swapped in.
+func (rb *Rebuilder) Apply(msg kafka.Message, handle func(kafka.Message)) {
+	rb.mu.RLock()
+	defer rb.mu.RUnlock()
+	handle(msg)
+}
+
+// Progress returns a snapshot of the latest rebuild, or nil if none has run.
+func (rb *Rebuilder) Progress() *RebuildProgress {
+	rb.progressMu.RLock()
+	defer rb.progressMu.RUnlock()
+
+	if rb.progress == nil {
+		return nil
+	}
+	snapshot := *rb.progress
+	snapshot.Topics = make(map[string]*TopicProgress, len(rb.progress.Topics))
+	snapshot.Processed = 0
+	for topic, tp := range rb.progress.Topics {
+		processed := atomic.LoadInt64(rb.processed[topic])
+		snapshot.Topics[topic] = &TopicProgress{Processed: processed, Total: tp.Total}
+		snapshot.Processed += processed
+	}
+	if snapshot.Total > 0 {
+		snapshot.Percent = float64(snapshot.Processed) / float64(snapshot.Total) * 100
+	} else if snapshot.Status == "completed" {
+		snapshot.Percent = 100
+	}
+	return &snapshot
+}
+
+// Wait blocks until the latest rebuild, if any, has finished.
+func (rb *Rebuilder) Wait() {
+	rb.progressMu.RLock()
+	done := rb.done
+	rb.progressMu.RUnlock()
+
+	if done != nil {
+		<-done
+	}
+}
+
+// Start launches a rebuild in the background and returns its initial progress.
+func (rb *Rebuilder) Start(reason string) (*RebuildProgress, error) {
+	rb.progressMu.Lock()
+	if rb.progress != nil && rb.progress.Status == "running" {
+		rb.progressMu.Unlock()
+		return nil, errRebuildRunning
+	}
+	started := time.Now()
+	rb.progress = &RebuildProgress{
+		ID:        fmt.Sprintf("%s-rebuild-%d", cfg.Kafka.GroupID, started.UnixNano()),
+		Status:    "running",
+		Reason:    reason,
+		StartedAt: started,
+		Topics:    make(map[string]*TopicProgress),
+	}
+	rb.processed = make(map[string]*int64)
+	rb.done = make(chan struct{})
+	for _, topic := range rb.topics {
+		rb.progress.Topics[topic] = &TopicProgress{}
+		rb.processed[topic] = new(int64)
+	}
+	id := rb.progress.ID
+	rb.progressMu.Unlock()
+
+	go func() {
+		err := rb.run(context.Background(), id)
+		rb.finish(err)
+	}()
+	return rb.Progress(), nil
+}
+
+func (rb *Rebuilder) run(ctx context.Context, id string) error {
+	slog.Info("Rebuilding order status projection", "rebuild_id", id)
+
+	staging, err := rb.sm.currentStore().Staging()
+	if err != nil {
+		return err
+	}
+
+	ranges := make(map[string]map[int]partitionRange, len(rb.topics))
+	var total int64
+	for _, topic := range rb.topics {
+		topicRanges, err := readPartitionRanges(ctx, topic)
+		if err != nil {
+			return err
+		}
+		ranges[topic] = topicRanges
+
+		var topicTotal int64
+		for _, r := range topicRanges {
+			topicTotal += r.End - r.First
+		}
+		total += topicTotal
+		rb.progressMu.Lock()
+		rb.progress.Topics[topic].Total = topicTotal
+		rb.progress.Total = total
+		rb.progressMu.Unlock()
+	}
+
+	stopLogging := rb.logProgress()
+	defer stopLogging()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(rb.topics))
+	for _, topic := range rb.topics {
+		wg.Add(1)
+		go func(topic string) {
+			defer wg.Done()
+			err := replayTopic(ctx, topic, ranges[topic], rb.replayInto(staging, topic))
+			if err != nil {
+				errs <- err
+			}
+		}(topic)
+	}
+	wg.Wait()
+	close(errs)
+	if err := <-errs; err != nil {
+		return err
+	}
+
+	// Stop live consumers here and writers in other replicas, then replay
+	// what arrived during the rebuild. Every message written to the live store
+	// so far is below the end offsets read now, so the swap loses none.
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	unlock, err := rb.sm.currentStore().LockWrites(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	for _, topic := range rb.topics {
+		current, err := readPartitionRanges(ctx, topic)
+		if err != nil {
+			return err
+		}
+		tail := make(map[int]partitionRange, len(current))
+		var tailTotal int64
+		for partition, r := range current {
+			if replayed, ok := ranges[topic][partition]; ok {
+				r.First = replayed.End
+			}
+			if r.End > r.First {
+				tail[partition] = r
+				tailTotal += r.End - r.First
+			}
+		}
+		rb.progressMu.Lock()
+		rb.progress.Topics[topic].Total += tailTotal
+		rb.progress.Total += tailTotal
+		rb.progressMu.Unlock()
+
+		if err := replayTopic(ctx, topic, tail, rb.replayInto(staging, topic)); err != nil {
+			return err
+		}
+	}
+
+	return rb.sm.ReplaceStore(staging)
+}
+
+// replayInto returns a handler that applies a replayed message of topic to
+// staging and counts it.
+func (rb *Rebuilder) replayInto(staging OrderStore, topic string) func(kafka.Message) {
+	counter := rb.processed[topic]
+	return func(msg kafka.Message) {
+		applyMessage(staging, msg)
+		atomic.AddInt64(counter, 1)
+	}
+}
+
+func (rb *Rebuilder) finish(err error) {
+	rb.progressMu.Lock()
+	finished := time.Now()
+	rb.progress.FinishedAt = &finished
+	if err != nil {
+		rb.progress.Status = "failed"
+		rb.progress.Error = err.Error()
+	} else {
+		rb.progress.Status = "completed"
+	}
+	close(rb.done)
+	rb.progressMu.Unlock()
+
+	progress := rb.Progress()
+	if err != nil {
+		slog.Error("Rebuild failed", "rebuild_id", progress.ID, "processed", progress.Processed, "error", err)
+		return
+	}
+	slog.Info("Rebuild completed", "rebuild_id", progress.ID, "processed", progress.Processed,
+		"duration", finished.Sub(progress.StartedAt).String())
+}
+
+// logProgress periodically logs rebuild progress until the returned func is called.
+func (rb *Rebuilder) logProgress() func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				p := rb.Progress()
+				slog.Info("Rebuild progress", "rebuild_id", p.ID, "processed", p.Processed, "total", p.Total, "percent", p.Percent)
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// applyMessage decodes a Kafka event and folds it into store without
+// notifying WebSocket clients.
+func applyMessage(store OrderStore, msg kafka.Message) {
+	event, ok := parseEvent(msg)
+	if !ok {
+		return
+	}
+	if _, _, err := applyEvent(store, event); err != nil {
+		slog.Error("Error rebuilding order", "order_id", event.OrderID, "event_id", event.ID, "topic", msg.Topic, "error", err)
+	}
+}
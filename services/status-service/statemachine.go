@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"shared/logging"
+)
+
+// Order lifecycle statuses. Status only ever moves forward along
+// orderTransitions; notification and fulfilment progress are tracked
+// separately in NotificationStatus and FulfilmentStatus.
+const (
+	StatusCreated            = "created"
+	StatusInventoryConfirmed = "inventory_confirmed"
+	StatusInventoryRejected  = "inventory_rejected"
+	StatusPaymentCompleted   = "payment_completed"
+	StatusPaymentFailed      = "payment_failed"
+	StatusShipped            = "shipped"
+)
+
+// Notification sub-statuses.
+const (
+	NotificationPending = "pending"
+	NotificationSent    = "sent"
+)
+
+// Fulfilment sub-statuses.
+const (
+	FulfilmentPending   = "pending"
+	FulfilmentShipped   = "shipped"
+	FulfilmentCancelled = "cancelled"
+)
+
+// orderTransitions lists the statuses directly reachable from each status.
+// Rejected, failed and shipped orders are terminal.
+var orderTransitions = map[string][]string{
+	StatusCreated:            {StatusInventoryConfirmed, StatusInventoryRejected},
+	StatusInventoryConfirmed: {StatusPaymentCompleted, StatusPaymentFailed},
+	StatusPaymentCompleted:   {StatusShipped},
+}
+
+// eventStatuses maps event types to the lifecycle status they move an order to.
+var eventStatuses = map[string]string{
+	"InventoryConfirmed": StatusInventoryConfirmed,
+	"InventoryRejected":  StatusInventoryRejected,
+	"PaymentCompleted":   StatusPaymentCompleted,
+	"PaymentFailed":      StatusPaymentFailed,
+	"Shipped":            StatusShipped,
+}
+
+// canTransition reports whether to is reachable from from in one or more steps.
+// Skipping intermediate statuses is allowed because the five topics are
+// consumed independently and a later stage can be seen before an earlier one.
+func canTransition(from, to string) bool {
+	for _, next := range orderTransitions[from] {
+		if next == to || canTransition(next, to) {
+			return true
+		}
+	}
+	return false
+}
+
+func fulfilmentStatus(status string) string {
+	switch status {
+	case StatusShipped:
+		return FulfilmentShipped
+	case StatusInventoryRejected, StatusPaymentFailed:
+		return FulfilmentCancelled
+	default:
+		return FulfilmentPending
+	}
+}
+
+// OrderEvent is a decoded event from any of the consumed topics.
+type OrderEvent struct {
+	ID         string
+	OrderID    string
+	Type       string
+	Data       map[string]interface{}
+	OccurredAt time.Time
+}
+
+// occurredAtFields are the payload fields producers use for the time an event
+// happened, in order of preference.
+var occurredAtFields = []string{"occurred_at", "processed_at", "sent_at", "shipped_at", "timestamp"}
+
+// parseEvent decodes a Kafka message into an OrderEvent. The event ID is a
+// fingerprint of the payload so redelivered or re-sent messages are recognised
+// as duplicates.
+func parseEvent(msg kafka.Message) (OrderEvent, bool) {
+	var data map[string]interface{}
+	if err := json.Unmarshal(msg.Value, &data); err != nil {
+		slog.Error("Error unmarshaling message", "topic", msg.Topic, "partition", msg.Partition, "offset", msg.Offset, "error", err)
+		return OrderEvent{}, false
+	}
+
+	orderID, _ := data["order_id"].(string)
+	eventType, _ := data["event_type"].(string)
+	if orderID == "" || eventType == "" {
+		return OrderEvent{}, false
+	}
+
+	event := OrderEvent{
+		ID:         logging.EventID(msg.Value),
+		OrderID:    orderID,
+		Type:       eventType,
+		Data:       data,
+		OccurredAt: msg.Time,
+	}
+	for _, field := range occurredAtFields {
+		if value, ok := data[field].(string); ok {
+			if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+				event.OccurredAt = t
+				break
+			}
+		}
+	}
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now()
+	}
+	return event, true
+}
+
+// foldEvent applies event to order (nil for an unseen order) and returns the
+// updated order, or nil if the event is a duplicate and nothing changed.
+//
+// Events can arrive before OrderCreated because each topic is consumed
+// independently. Such orders are kept as provisional: later-stage events still
+// advance the status and fill in product and quantity, and OrderCreated only
+// confirms the order details without resetting its status.
+func foldEvent(order *OrderStatus, event OrderEvent) *OrderStatus {
+	if order == nil {
+		order = &OrderStatus{
+			OrderID:            event.OrderID,
+			Status:             StatusCreated,
+			NotificationStatus: NotificationPending,
+			FulfilmentStatus:   FulfilmentPending,
+			Provisional:        true,
+			CreatedAt:          event.OccurredAt,
+			Events:             make([]EventRecord, 0),
+		}
+	}
+
+	for _, existing := range order.Events {
+		if existing.ID == event.ID {
+			return nil
+		}
+	}
+
+	dataBytes, _ := json.Marshal(event.Data)
+	order.Events = append(order.Events, EventRecord{
+		ID:         event.ID,
+		EventType:  event.Type,
+		Data:       string(dataBytes),
+		OccurredAt: event.OccurredAt,
+		Timestamp:  time.Now(),
+	})
+	sort.SliceStable(order.Events, func(i, j int) bool {
+		return order.Events[i].OccurredAt.Before(order.Events[j].OccurredAt)
+	})
+
+	order.LastUpdated = time.Now()
+	if event.OccurredAt.After(order.LastEventAt) {
+		order.LastEventAt = event.OccurredAt
+	}
+
+	switch event.Type {
+	case "OrderCreated":
+		// OrderCreated carries the order as placed, so it wins over details
+		// backfilled from earlier-consumed events.
+		if productID, ok := event.Data["product_id"].(string); ok && productID != "" {
+			order.ProductID = productID
+		}
+		if quantity, ok := event.Data["quantity"].(float64); ok && quantity > 0 {
+			order.Quantity = int(quantity)
+		}
+		if customerID, ok := event.Data["customer_id"].(string); ok && customerID != "" {
+			order.CustomerID = customerID
+		}
+		order.Provisional = false
+		order.CreatedAt = event.OccurredAt
+	case "PaymentCompleted":
+		if amount, ok := event.Data["amount"].(float64); ok {
+			order.PaymentAmount = amount
+		}
+	case "NotificationSent":
+		order.NotificationStatus = NotificationSent
+	case "Shipped":
+		if trackingNumber, ok := event.Data["tracking_number"].(string); ok {
+			order.TrackingNumber = trackingNumber
+		}
+	}
+
+	if order.Provisional {
+		backfillOrderDetails(order, event)
+	}
+
+	if target, ok := eventStatuses[event.Type]; ok {
+		if canTransition(order.Status, target) {
+			order.Status = target
+		} else if order.Status != target {
+			slog.Warn("Ignoring out-of-order event", "order_id", order.OrderID, "event_id", event.ID, "event_type", event.Type, "status", order.Status)
+		}
+	}
+	order.FulfilmentStatus = fulfilmentStatus(order.Status)
+
+	return order
+}
+
+// backfillOrderDetails fills product, customer, quantity and creation time from any
+// event while the order is still waiting for its OrderCreated event.
+func backfillOrderDetails(order *OrderStatus, event OrderEvent) {
+	if productID, ok := event.Data["product_id"].(string); ok && productID != "" && order.ProductID == "" {
+		order.ProductID = productID
+	}
+	if customerID, ok := event.Data["customer_id"].(string); ok && customerID != "" && order.CustomerID == "" {
+		order.CustomerID = customerID
+	}
+	if quantity, ok := event.Data["quantity"].(float64); ok && quantity > 0 && order.Quantity == 0 {
+		order.Quantity = int(quantity)
+	}
+	if event.OccurredAt.Before(order.CreatedAt) {
+		order.CreatedAt = event.OccurredAt
+	}
+}
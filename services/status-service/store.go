@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OrderStore is the storage backend behind StatusManager. Implementations must
+// return copies so callers can never mutate stored state directly.
+type OrderStore interface {
+	// Get returns a single order with its full event history.
+	Get(orderID string) (*OrderStatus, bool, error)
+	// Update runs fn against the current order (nil if it does not exist yet)
+	// and persists whatever fn returns, atomically with respect to other updates
+	// of the same order. Events appended by fn are stored as new events.
+	Update(orderID string, fn func(order *OrderStatus) *OrderStatus) (*OrderStatus, error)
+	// Delete removes an order and its events.
+	Delete(orderID string) (bool, error)
+	// List returns every order, newest first.
+	List() ([]*OrderStatus, error)
+	// Filter returns orders matching filter, newest first, paginated.
+	Filter(filter OrderFilter) ([]*OrderStatus, error)
+	// Search matches query against order ID, product ID, status and tracking number.
+	Search(query string) ([]*OrderStatus, error)
+	// DateRange returns orders last updated strictly between from and to.
+	DateRange(from, to time.Time) ([]*OrderStatus, error)
+	// Staging returns an empty store of the same kind for a rebuild to fill.
+	Staging() (OrderStore, error)
+	// Promote atomically replaces this store's contents with a filled staging
+	// store and returns the store to use from then on.
+	Promote(staging OrderStore) (OrderStore, error)
+	// LockWrites blocks Update and Delete on this store, in every replica
+	// sharing it, until the returned func is called.
+	LockWrites(ctx context.Context) (unlock func(), err error)
+	// Ping reports whether the backend is reachable.
+	Ping(ctx context.Context) error
+	// Close releases any resources held by the store.
+	Close() error
+}
+
+// newOrderStore picks the storage backend from the configuration: Postgres
+// when a database URL is set, otherwise the in-memory store.
+func newOrderStore() (OrderStore, error) {
+	if dsn := cfg.DatabaseURL; dsn != "" {
+		slog.Info("Using Postgres order store")
+		return NewPostgresStore(dsn)
+	}
+	slog.Info("Using in-memory order store")
+	return NewMemoryStore(), nil
+}
+
+// dateRange parses DateFrom/DateTo (YYYY-MM-DD). DateTo is extended to the end
+// of that day. Unparseable values are logged and ignored.
+func (f OrderFilter) dateRange() (from, to time.Time) {
+	var err error
+	if f.DateFrom != "" {
+		from, err = time.Parse("2006-01-02", f.DateFrom)
+		if err != nil {
+			slog.Warn("Invalid date_from format", "error", err)
+		}
+	}
+	if f.DateTo != "" {
+		to, err = time.Parse("2006-01-02", f.DateTo)
+		if err != nil {
+			slog.Warn("Invalid date_to format", "error", err)
+		} else {
+			to = to.Add(23*time.Hour + 59*time.Minute + 59*time.Second) // End of day
+		}
+	}
+	return from, to
+}
+
+func copyOrder(order *OrderStatus) *OrderStatus {
+	orderCopy := *order
+	eventsCopy := make([]EventRecord, len(order.Events))
+	copy(eventsCopy, order.Events)
+	orderCopy.Events = eventsCopy
+	return &orderCopy
+}
+
+func sortNewestFirst(orders []*OrderStatus) {
+	sort.Slice(orders, func(i, j int) bool {
+		return orders[i].LastUpdated.After(orders[j].LastUpdated)
+	})
+}
+
+// MemoryStore keeps orders in a process-local map. State is lost on restart,
+// so it is normally paired with a startup rebuild from Kafka.
+type MemoryStore struct {
+	mu     sync.RWMutex
+	orders map[string]*OrderStatus
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		orders: make(map[string]*OrderStatus),
+	}
+}
+
+func (ms *MemoryStore) Get(orderID string) (*OrderStatus, bool, error) {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	order, exists := ms.orders[orderID]
+	if !exists {
+		return nil, false, nil
+	}
+	return copyOrder(order), true, nil
+}
+
+func (ms *MemoryStore) Update(orderID string, fn func(order *OrderStatus) *OrderStatus) (*OrderStatus, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	var current *OrderStatus
+	if order, exists := ms.orders[orderID]; exists {
+		current = copyOrder(order)
+	}
+
+	updated := fn(current)
+	if updated == nil {
+		return current, nil
+	}
+	ms.orders[orderID] = copyOrder(updated)
+	return updated, nil
+}
+
+func (ms *MemoryStore) Delete(orderID string) (bool, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if _, exists := ms.orders[orderID]; !exists {
+		return false, nil
+	}
+	delete(ms.orders, orderID)
+	return true, nil
+}
+
+func (ms *MemoryStore) List() ([]*OrderStatus, error) {
+	return ms.collect(func(*OrderStatus) bool { return true }), nil
+}
+
+func (ms *MemoryStore) Filter(filter OrderFilter) ([]*OrderStatus, error) {
+	dateFrom, dateTo := filter.dateRange()
+
+	result := ms.collect(func(v *OrderStatus) bool {
+		if filter.Status != "" && v.Status != filter.Status {
+			return false
+		}
+		if filter.ProductID != "" && v.ProductID != filter.ProductID {
+			return false
+		}
+		if !dateFrom.IsZero() && v.LastUpdated.Before(dateFrom) {
+			return false
+		}
+		if !dateTo.IsZero() && v.LastUpdated.After(dateTo) {
+			return false
+		}
+		return true
+	})
+
+	// Apply pagination
+	if filter.Offset > 0 {
+		if filter.Offset >= len(result) {
+			return []*OrderStatus{}, nil
+		}
+		result = result[filter.Offset:]
+	}
+	if filter.Limit > 0 && filter.Limit < len(result) {
+		result = result[:filter.Limit]
+	}
+	return result, nil
+}
+
+func (ms *MemoryStore) Search(query string) ([]*OrderStatus, error) {
+	queryLower := strings.ToLower(query)
+	return ms.collect(func(order *OrderStatus) bool {
+		return strings.Contains(strings.ToLower(order.OrderID), queryLower) ||
+			strings.Contains(strings.ToLower(order.ProductID), queryLower) ||
+			strings.Contains(strings.ToLower(order.Status), queryLower) ||
+			strings.Contains(strings.ToLower(order.TrackingNumber), queryLower)
+	}), nil
+}
+
+func (ms *MemoryStore) DateRange(from, to time.Time) ([]*OrderStatus, error) {
+	return ms.collect(func(order *OrderStatus) bool {
+		return order.LastUpdated.After(from) && order.LastUpdated.Before(to)
+	}), nil
+}
+
+func (ms *MemoryStore) Staging() (OrderStore, error) {
+	return NewMemoryStore(), nil
+}
+
+// Promote simply hands back the staging map; swapping the pointer held by
+// StatusManager is the atomic step.
+func (ms *MemoryStore) Promote(staging OrderStore) (OrderStore, error) {
+	return staging, nil
+}
+
+// LockWrites has nothing to do: the map belongs to this replica alone, and
+// the Rebuilder already holds back its consumers.
+func (ms *MemoryStore) LockWrites(ctx context.Context) (func(), error) {
+	return func() {}, nil
+}
+
+func (ms *MemoryStore) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (ms *MemoryStore) Close() error {
+	return nil
+}
+
+// collect copies every order accepted by match, newest first.
+func (ms *MemoryStore) collect(match func(*OrderStatus) bool) []*OrderStatus {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	result := make([]*OrderStatus, 0)
+	for _, order := range ms.orders {
+		if match(order) {
+			result = append(result, copyOrder(order))
+		}
+	}
+	sortNewestFirst(result)
+	return result
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// Recent events kept for Last-Event-ID resume.
+	replayBufferSize = 1024
+	// Events queued per SSE connection before it is dropped as a slow client.
+	streamQueueSize = 64
+	// Interval between keep-alive comments so idle proxies don't close streams.
+	streamHeartbeat = 15 * time.Second
+)
+
+// StreamEntry is one event in the replay buffer. ID is "<epoch>-<seq>"; the
+// epoch changes on every restart so stale IDs from a previous process are
+// recognised instead of silently skipping events.
+type StreamEntry struct {
+	ID      string      `json:"id"`
+	OrderID string      `json:"order_id"`
+	Event   EventRecord `json:"event"`
+	Status  string      `json:"status"`
+
+	seq uint64
+}
+
+type streamSubscriber struct {
+	orderID string // empty for all orders
+	entries chan StreamEntry
+}
+
+// EventStream is a bounded in-memory log of recently applied events that SSE
+// connections tail and resume from.
+type EventStream struct {
+	mu          sync.Mutex
+	epoch       string
+	nextSeq     uint64
+	buffer      []StreamEntry // ring buffer, oldest at start
+	start       int
+	subscribers map[*streamSubscriber]struct{}
+}
+
+func NewEventStream() *EventStream {
+	return &EventStream{
+		epoch:       strconv.FormatInt(time.Now().UnixNano(), 36),
+		nextSeq:     1,
+		buffer:      make([]StreamEntry, 0, replayBufferSize),
+		subscribers: make(map[*streamSubscriber]struct{}),
+	}
+}
+
+// Publish appends an event to the replay buffer and hands it to every
+// matching subscriber. Subscribers that cannot keep up are disconnected.
+func (es *EventStream) Publish(order *OrderStatus, record EventRecord) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	entry := StreamEntry{
+		ID:      fmt.Sprintf("%s-%d", es.epoch, es.nextSeq),
+		OrderID: order.OrderID,
+		Event:   record,
+		Status:  order.Status,
+		seq:     es.nextSeq,
+	}
+	es.nextSeq++
+
+	if len(es.buffer) < replayBufferSize {
+		es.buffer = append(es.buffer, entry)
+	} else {
+		es.buffer[es.start] = entry
+		es.start = (es.start + 1) % replayBufferSize
+	}
+
+	for sub := range es.subscribers {
+		if sub.orderID != "" && sub.orderID != entry.OrderID {
+			continue
+		}
+		select {
+		case sub.entries <- entry:
+		default:
+			slog.Warn("Dropping slow SSE client", "order_id", sub.orderID)
+			delete(es.subscribers, sub)
+			close(sub.entries)
+		}
+	}
+}
+
+// Subscribe registers a subscriber for orderID (empty for all orders) and
+// returns the buffered events after lastEventID. resumed is false when
+// lastEventID was given but is unknown or already evicted, in which case the
+// client may have missed events and should refetch current state.
+func (es *EventStream) Subscribe(orderID, lastEventID string) (sub *streamSubscriber, backlog []StreamEntry, resumed bool) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	sub = &streamSubscriber{
+		orderID: orderID,
+		entries: make(chan StreamEntry, streamQueueSize),
+	}
+	es.subscribers[sub] = struct{}{}
+
+	if lastEventID == "" {
+		return sub, nil, true
+	}
+
+	epoch, seqStr, ok := strings.Cut(lastEventID, "-")
+	seq, err := strconv.ParseUint(seqStr, 10, 64)
+	if !ok || err != nil || epoch != es.epoch || seq >= es.nextSeq {
+		return sub, nil, false
+	}
+
+	resumed = len(es.buffer) == 0 || es.at(0).seq <= seq+1
+	for i := 0; i < len(es.buffer); i++ {
+		entry := es.at(i)
+		if entry.seq > seq && (orderID == "" || entry.OrderID == orderID) {
+			backlog = append(backlog, entry)
+		}
+	}
+	return sub, backlog, resumed
+}
+
+// Unsubscribe removes a subscriber. Safe to call after it has been dropped.
+func (es *EventStream) Unsubscribe(sub *streamSubscriber) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	if _, exists := es.subscribers[sub]; exists {
+		delete(es.subscribers, sub)
+		close(sub.entries)
+	}
+}
+
+func (es *EventStream) at(i int) StreamEntry {
+	return es.buffer[(es.start+i)%len(es.buffer)]
+}
+
+// serveEventStream streams events for orderID (empty for all orders) as
+// Server-Sent Events. Each event carries its ID so browsers resume with
+// Last-Event-ID after a reconnect. If the resume point is no longer buffered a
+// "reset" event is sent first; order streams also start with an "order"
+// snapshot in that case and on a fresh connection.
+func serveEventStream(c *gin.Context, orderID string) {
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+
+	// Subscribe before loading the snapshot so no event falls in between; an
+	// event may then appear in both, which clients can ignore by event ID.
+	sub, backlog, resumed := statusManager.stream.Subscribe(orderID, lastEventID)
+	defer statusManager.stream.Unsubscribe(sub)
+
+	var snapshot *OrderStatus
+	if orderID != "" {
+		order, exists, err := statusManager.GetOrderStatus(orderID)
+		if err != nil {
+			storeError(c, err)
+			return
+		}
+		if exists {
+			snapshot = order
+		}
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // disable nginx response buffering
+	c.Status(http.StatusOK)
+
+	if !resumed {
+		writeSSE(c, "", "reset", gin.H{"reason": "Last-Event-ID is no longer available"})
+	}
+	if snapshot != nil && (lastEventID == "" || !resumed) {
+		writeSSE(c, "", "order", snapshot)
+	}
+	for _, entry := range backlog {
+		writeSSE(c, entry.ID, "event", entry)
+	}
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case entry, ok := <-sub.entries:
+			if !ok {
+				return
+			}
+			writeSSE(c, entry.ID, "event", entry)
+		case <-heartbeat.C:
+			fmt.Fprint(c.Writer, ": keep-alive\n\n")
+		}
+		c.Writer.Flush()
+	}
+}
+
+func writeSSE(c *gin.Context, id, event string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		slog.Error("Error marshaling SSE payload", "event", event, "error", err)
+		return
+	}
+	if id != "" {
+		fmt.Fprintf(c.Writer, "id: %s\n", id)
+	}
+	fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", event, payload)
+}
+
+func streamAllEvents(c *gin.Context) {
+	serveEventStream(c, "")
+}
+
+func streamOrderEvents(c *gin.Context) {
+	serveEventStream(c, c.Param("orderId"))
+}